@@ -0,0 +1,297 @@
+// Package checkpoint saves and restores a model with its vocabulary.
+//
+// A checkpoint file is a gob stream holding a magic string, a Header, the model, the vocabulary
+// and, if the header is Resumable, what is needed to resume the training.
+// Gob writes the entries of a map in the random order of its iteration, so the metrics of the header
+// and the accumulators of the solver follow their holder as slices sorted by key, and the vocabulary
+// is written as its tokens in the order of their indices: the same checkpoint is always written as
+// the same bytes.
+// It is written to a temporary file renamed over the destination, so a crash never leaves
+// a partially written checkpoint behind.
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/owulveryck/lstm"
+	G "gorgonia.org/gorgonia"
+
+	"github.com/fahri-r/iteung-go/vocab"
+)
+
+// FormatVersion is the version of the files written by Save
+const FormatVersion = 1
+
+// magic starts every checkpoint file
+const magic = "iteung-go checkpoint"
+
+// ErrNotCheckpoint is returned when loading a file that has not been written by Save,
+// such as the gob files written before the checkpoints were versioned
+var ErrNotCheckpoint = errors.New("not a checkpoint file")
+
+// Header describes the content of a checkpoint
+type Header struct {
+	// Version is the FormatVersion of the file
+	Version int
+	// Model holds the sizes of the model
+	Model lstm.ModelConfig
+	// VocabularySize is the number of tokens of the vocabulary
+	VocabularySize int
+	// VocabularyChecksum identifies the tokens of the vocabulary and their indices
+	VocabularyChecksum string
+	// Step and Epoch tell when the checkpoint was taken
+	Step  int
+	Epoch int
+	// Metrics holds the losses at the time of the checkpoint, by name
+	Metrics map[string]float64
+	// Time is the time of the checkpoint
+	Time time.Time
+	// Resumable is true if the file holds a Resume section
+	Resumable bool
+	// Config is the configuration of the training that wrote the checkpoint, in the format of
+	// the trainer; it is empty if the checkpoint was saved without one
+	Config []byte
+}
+
+// Checkpoint is a model with its vocabulary
+type Checkpoint struct {
+	Header     Header
+	Model      *lstm.Model
+	Vocabulary vocab.InferenceVocabulary[string, int]
+	// Resume is nil if the training cannot be resumed from the checkpoint
+	Resume *Resume
+}
+
+// Resume is what a training needs, along with the model, to continue where the checkpoint has been taken
+type Resume struct {
+	// Training holds the step, the epoch, the early stopping state and the memory of the training
+	Training lstm.TrainingState
+	// Solver holds the accumulators of the solver
+	Solver G.SolverState
+	// DatasetEpoch and DatasetOffset are the position of the training set
+	DatasetEpoch  int
+	DatasetOffset int
+	// Seed is the seed the training set is shuffled with
+	Seed int64
+}
+
+// VocabularyChecksum returns the hex encoded sha256 of the tokens of v in the order of their indices
+func VocabularyChecksum(v vocab.InferenceVocabulary[string, int]) string {
+	h := sha256.New()
+	for i := 0; i < len(v.Inverse); i++ {
+		fmt.Fprintf(h, "%d:%q\n", i, v.Inverse[i])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Save writes c to path. The version, the model config, the vocabulary fields and,
+// if it is not set, the time of the header are filled from the content of c.
+// The vocabulary must index its tokens from 0
+func Save(path string, c *Checkpoint) error {
+	if c.Model == nil {
+		return errors.New("no model to save")
+	}
+	c.Header.Version = FormatVersion
+	c.Header.Model = c.Model.Config()
+	c.Header.VocabularySize = len(c.Vocabulary.Forward)
+	c.Header.VocabularyChecksum = VocabularyChecksum(c.Vocabulary)
+	c.Header.Resumable = c.Resume != nil
+	if c.Header.Time.IsZero() {
+		c.Header.Time = time.Now()
+	}
+	tokens, err := vocabularyTokens(c.Vocabulary)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	// the temporary file is removed unless it has been renamed
+	defer os.Remove(f.Name())
+	enc := gob.NewEncoder(f)
+	header := c.Header
+	header.Metrics = nil
+	values := []interface{}{magic, header, sortedEntries(c.Header.Metrics), c.Model, tokens}
+	if c.Resume != nil {
+		resume := *c.Resume
+		resume.Solver.Params = nil
+		values = append(values, resume, sortedEntries(c.Resume.Solver.Params))
+	}
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// readHeader checks the magic string and the version of the stream and returns its header
+func readHeader(dec *gob.Decoder) (Header, error) {
+	var m string
+	if err := dec.Decode(&m); err != nil || m != magic {
+		return Header{}, ErrNotCheckpoint
+	}
+	var h Header
+	if err := dec.Decode(&h); err != nil {
+		return Header{}, fmt.Errorf("cannot read the checkpoint header: %v", err)
+	}
+	if h.Version != FormatVersion {
+		return Header{}, fmt.Errorf("checkpoint format version %d is not supported (expected %d)", h.Version, FormatVersion)
+	}
+	var metrics []entry[float64]
+	if err := dec.Decode(&metrics); err != nil {
+		return Header{}, fmt.Errorf("cannot read the checkpoint metrics: %v", err)
+	}
+	h.Metrics = entriesMap(metrics)
+	return h, nil
+}
+
+// ReadHeader returns the header of the checkpoint stored in path without reading the model
+func ReadHeader(path string) (Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Header{}, err
+	}
+	defer f.Close()
+	return readHeader(gob.NewDecoder(f))
+}
+
+// Load reads the checkpoint stored in path. It fails if the file is not a checkpoint,
+// if its version is not supported or if the model and the vocabulary do not match the header
+func Load(path string) (*Checkpoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return read(f)
+}
+
+func read(r io.Reader) (*Checkpoint, error) {
+	dec := gob.NewDecoder(r)
+	h, err := readHeader(dec)
+	if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{
+		Header: h,
+		Model:  new(lstm.Model),
+	}
+	if err := dec.Decode(c.Model); err != nil {
+		return nil, fmt.Errorf("cannot read the model: %v", err)
+	}
+	var tokens []string
+	if err := dec.Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("cannot read the vocabulary: %v", err)
+	}
+	c.Vocabulary = tokensVocabulary(tokens)
+	if config := c.Model.Config(); config != h.Model {
+		return nil, fmt.Errorf("the model %+v does not match the header %+v", config, h.Model)
+	}
+	if err := h.Compatible(h.Model, c.Vocabulary); err != nil {
+		return nil, err
+	}
+	if h.Resumable {
+		c.Resume = new(Resume)
+		if err := dec.Decode(c.Resume); err != nil {
+			return nil, fmt.Errorf("cannot read the training state: %v", err)
+		}
+		var params []entry[G.ParamState]
+		if err := dec.Decode(&params); err != nil {
+			return nil, fmt.Errorf("cannot read the solver state: %v", err)
+		}
+		c.Resume.Solver.Params = entriesMap(params)
+	}
+	return c, nil
+}
+
+// Compatible returns an error if a model of the given config trained with v cannot be restored from the checkpoint
+func (h Header) Compatible(config lstm.ModelConfig, v vocab.InferenceVocabulary[string, int]) error {
+	if config != h.Model {
+		return fmt.Errorf("the checkpoint holds a model of sizes %+v, expected %+v", h.Model, config)
+	}
+	if len(v.Forward) != h.VocabularySize || VocabularyChecksum(v) != h.VocabularyChecksum {
+		return fmt.Errorf("the vocabulary (%d tokens) differs from the one of the checkpoint (%d tokens)", len(v.Forward), h.VocabularySize)
+	}
+	if h.Model.InputSize != h.VocabularySize {
+		return fmt.Errorf("the model reads %d tokens but the vocabulary holds %d tokens", h.Model.InputSize, h.VocabularySize)
+	}
+	return nil
+}
+
+// entry is an entry of a map, which is written as its entries sorted by key
+type entry[V any] struct {
+	Key   string
+	Value V
+}
+
+func sortedEntries[V any](m map[string]V) []entry[V] {
+	entries := make([]entry[V], 0, len(m))
+	for k, v := range m {
+		entries = append(entries, entry[V]{Key: k, Value: v})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
+func entriesMap[V any](entries []entry[V]) map[string]V {
+	if len(entries) == 0 {
+		return nil
+	}
+	m := make(map[string]V, len(entries))
+	for _, e := range entries {
+		m[e.Key] = e.Value
+	}
+	return m
+}
+
+// vocabularyTokens returns the tokens of v in the order of their indices, which must go from 0 to the
+// size of the vocabulary
+func vocabularyTokens(v vocab.InferenceVocabulary[string, int]) ([]string, error) {
+	tokens := make([]string, len(v.Forward))
+	for i := range tokens {
+		tk, ok := v.Inverse[i]
+		if !ok || v.Forward[tk] != i {
+			return nil, fmt.Errorf("the vocabulary does not index its %d tokens from 0 to %d", len(v.Forward), len(v.Forward)-1)
+		}
+		tokens[i] = tk
+	}
+	if len(v.Inverse) != len(tokens) {
+		return nil, fmt.Errorf("the vocabulary holds %d tokens but %d indices", len(tokens), len(v.Inverse))
+	}
+	return tokens, nil
+}
+
+// tokensVocabulary returns the vocabulary of the tokens, indexed by their position
+func tokensVocabulary(tokens []string) vocab.InferenceVocabulary[string, int] {
+	v := vocab.InferenceVocabulary[string, int]{
+		Forward: make(map[string]int, len(tokens)),
+		Inverse: make(map[int]string, len(tokens)),
+	}
+	for i, tk := range tokens {
+		v.Forward[tk] = i
+		v.Inverse[i] = tk
+	}
+	return v
+}
@@ -0,0 +1,237 @@
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/lstm"
+	"github.com/owulveryck/lstm/datasetter/char"
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+
+	"github.com/fahri-r/iteung-go/vocab"
+)
+
+func testVocabulary(tokens ...string) vocab.InferenceVocabulary[string, int] {
+	v := vocab.InferenceVocabulary[string, int]{
+		Forward: make(map[string]int),
+		Inverse: make(map[int]string),
+	}
+	for i, tk := range tokens {
+		v.Forward[tk] = i
+		v.Inverse[i] = tk
+	}
+	return v
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.bin")
+	c := &Checkpoint{
+		Header: Header{
+			Step:    100,
+			Epoch:   2,
+			Metrics: map[string]float64{"validation_loss": 1.5},
+			Config:  []byte(`{"model":{"hidden_size":4}}`),
+		},
+		Model:      lstm.NewModel(3, 3, 4),
+		Vocabulary: testVocabulary("\n", "a", "b"),
+	}
+	if err := Save(path, c); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Header.Step != 100 || loaded.Header.Epoch != 2 || loaded.Header.Metrics["validation_loss"] != 1.5 ||
+		string(loaded.Header.Config) != string(c.Header.Config) {
+		t.Fatalf("bad header %+v", loaded.Header)
+	}
+	if loaded.Header.Model != (lstm.ModelConfig{InputSize: 3, OutputSize: 3, HiddenSize: 4}) {
+		t.Fatalf("bad model config %+v", loaded.Header.Model)
+	}
+	if !reflect.DeepEqual(loaded.Vocabulary, c.Vocabulary) {
+		t.Fatalf("bad vocabulary %v", loaded.Vocabulary)
+	}
+	original, _ := c.Model.MarshalBinary()
+	restored, _ := loaded.Model.MarshalBinary()
+	if !reflect.DeepEqual(original, restored) {
+		t.Fatal("the weights differ")
+	}
+
+	// a smaller checkpoint replaces the file completely
+	c.Model = lstm.NewModel(2, 2, 1)
+	c.Vocabulary = testVocabulary("\n", "a")
+	if err := Save(path, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Fatalf("the temporary files should be removed, got %v files", len(entries))
+	}
+	if loaded.Resume != nil {
+		t.Fatal("a checkpoint saved without training state should not be resumable")
+	}
+
+	c.Resume = &Resume{
+		Training: lstm.TrainingState{Step: 100, Epoch: 2, BestLoss: 1.5, Hidden: []float32{0.5}, Cell: []float32{-0.5}},
+		Solver: G.SolverState{
+			Iter: 100,
+			Params: map[string]G.ParamState{
+				"Wy": {Shape: tensor.Shape{2, 1}, Accumulators: [][]float64{{0.1, 0.2}, {0.3, 0.4}}},
+			},
+		},
+		DatasetEpoch:  2,
+		DatasetOffset: 7,
+		Seed:          42,
+	}
+	if err := Save(path, c); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Header.Resumable || !reflect.DeepEqual(loaded.Resume, c.Resume) {
+		t.Fatalf("bad training state %+v", loaded.Resume)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, values ...interface{}) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		enc := gob.NewEncoder(f)
+		for _, v := range values {
+			if err := enc.Encode(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return path
+	}
+	model := lstm.NewModel(3, 3, 4)
+	v := testVocabulary("\n", "a", "b")
+
+	// the gob files written before the versioned format
+	old := write("old.bin", struct {
+		Model      *lstm.Model
+		Vocabulary vocab.InferenceVocabulary[string, int]
+	}{model, v})
+	if _, err := Load(old); !errors.Is(err, ErrNotCheckpoint) {
+		t.Fatalf("expected ErrNotCheckpoint, got %v", err)
+	}
+
+	future := write("future.bin", magic, Header{Version: FormatVersion + 1})
+	if _, err := Load(future); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Fatalf("expected a version error, got %v", err)
+	}
+
+	header := Header{
+		Version:            FormatVersion,
+		Model:              model.Config(),
+		VocabularySize:     3,
+		VocabularyChecksum: VocabularyChecksum(testVocabulary("\n", "b", "a")),
+	}
+	tokens := []string{"\n", "a", "b"}
+	swapped := write("swapped.bin", magic, header, []entry[float64]{}, model, tokens)
+	if _, err := Load(swapped); err == nil || !strings.Contains(err.Error(), "vocabulary") {
+		t.Fatalf("expected a vocabulary error, got %v", err)
+	}
+
+	header.VocabularyChecksum = VocabularyChecksum(v)
+	header.Model.HiddenSize = 5
+	resized := write("resized.bin", magic, header, []entry[float64]{}, model, tokens)
+	if _, err := Load(resized); err == nil {
+		t.Fatal("expected an error for a model not matching the header")
+	}
+
+	gaps := testVocabulary("\n", "a", "b")
+	delete(gaps.Inverse, 1)
+	gaps.Inverse[3] = "a"
+	if err := Save(filepath.Join(dir, "gaps.bin"), &Checkpoint{Model: model, Vocabulary: gaps}); err == nil {
+		t.Fatal("expected an error for a vocabulary not indexed from 0")
+	}
+}
+
+func TestSeededCheckpoint(t *testing.T) {
+	v := testVocabulary("\n", "a", "b", "c", "d")
+	runeToIdx := func(r string) (int, error) {
+		idx, ok := v.Forward[r]
+		if !ok {
+			return 0, errors.New("unknown token")
+		}
+		return idx, nil
+	}
+	idxToRune := func(i int) (string, error) {
+		tk, ok := v.Inverse[i]
+		if !ok {
+			return "", errors.New("unknown index")
+		}
+		return tk, nil
+	}
+	dir := t.TempDir()
+	// run trains a model with seed and returns the bytes of its checkpoint
+	run := func(name string, seed int64) []byte {
+		m := lstm.NewModel(5, 5, 4, lstm.WithSeed(seed))
+		tset := char.NewTrainingSet(strings.NewReader("a b c d a\nb c a d b c\n"), runeToIdx, idxToRune, 5, 3, 2, char.WithShuffle(seed))
+		solver := G.NewAdamSolver()
+		infos, err := lstm.NewTrainer(m, solver, lstm.WithEpochs(2)).Run(context.Background(), tset)
+		if err != io.EOF {
+			t.Fatalf("expected io.EOF, got %v", err)
+		}
+		state, err := solver.State()
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset, _ := tset.Position()
+		path := filepath.Join(dir, name)
+		err = Save(path, &Checkpoint{
+			Header: Header{
+				Step:    infos.Step,
+				Epoch:   infos.Epoch,
+				Metrics: map[string]float64{"loss": float64(infos.Cost), "perplexity": float64(infos.Perplexity)},
+				Time:    time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			},
+			Model:      m,
+			Vocabulary: v,
+			Resume: &Resume{
+				Training:      infos.State,
+				Solver:        state,
+				DatasetEpoch:  tset.Epoch(),
+				DatasetOffset: offset,
+				Seed:          seed,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	first := run("first.bin", 42)
+	if second := run("second.bin", 42); !bytes.Equal(first, second) {
+		t.Fatal("two trainings with the same seed should write the same checkpoint")
+	}
+	if other := run("other.bin", 43); bytes.Equal(first, other) {
+		t.Fatal("trainings with different seeds should write different checkpoints")
+	}
+}
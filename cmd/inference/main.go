@@ -2,17 +2,18 @@ package main
 
 import (
 	"context"
-	"encoding/gob"
+	"flag"
 	"fmt"
 	_"io/ioutil"
 	"log"
-	"os"
 	"strings"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/owulveryck/lstm"
 	"github.com/owulveryck/lstm/datasetter/char"
+	"github.com/owulveryck/lstm/datasetter/qa"
 
+	"github.com/fahri-r/iteung-go/checkpoint"
 	."github.com/fahri-r/iteung-go/vocab"
 )
 
@@ -20,60 +21,109 @@ type configuration struct {
 	Dump string `envconfig:"dump" default:"checkpoint.bin"`
 }
 
-type backup struct {
-	Model      lstm.Model
-	Vocabulary Vocabulary[string, int]
-}
-
 func main() {
 	
 	// efore we brt we bus repetition. the superfluity say, he catunt thones not urfeits, er abe can bust ne
 
+	samplerName := flag.String("sampler", "greedy", "sampling strategy: greedy, temperature, topk or topp")
+	temperature := flag.Float64("temperature", 1, "temperature of the temperature, topk and topp samplers")
+	topK := flag.Int("k", 10, "number of candidates of the topk sampler")
+	topP := flag.Float64("p", 0.9, "cumulative probability of the topp sampler")
+	penalty := flag.Float64("repetition-penalty", 1, "divides the probability of already generated tokens (1 disables it)")
+	seed := flag.Int64("seed", 0, "seed of the random samplers (0 uses the current time)")
+	beamWidth := flag.Int("beam", 0, "width of the beam search (0 samples a single answer)")
+	nBest := flag.Int("nbest", 3, "number of answers printed by the beam search")
+	lengthPenalty := flag.Float64("length-penalty", 0.6, "length normalization of the beam search scores")
+	minConfidence := flag.Float64("min-confidence", 0, "answers below this confidence are replaced by the fallback")
+	fallback := flag.String("fallback", "aku tidak tahu", "answer given when the confidence is too low")
+	verbose := flag.Bool("v", false, "print the probability and the entropy of every generated token")
+	qaFormat := flag.Bool("qa", false, "end the prompt with the separator of a model trained on question and answer pairs")
+	flag.Parse()
+
+	var sampler char.Sampler
+	switch *samplerName {
+	case "greedy":
+		sampler = char.NewGreedySampler()
+	case "temperature":
+		sampler = char.NewTemperatureSampler(*temperature, char.NewRand(*seed))
+	case "topk":
+		sampler = char.NewTopKSampler(*topK, *temperature, char.NewRand(*seed))
+	case "topp":
+		sampler = char.NewTopPSampler(*topP, *temperature, char.NewRand(*seed))
+	default:
+		log.Fatalf("unknown sampler %v", *samplerName)
+	}
+	if *penalty != 1 {
+		sampler = char.NewRepetitionPenalty(*penalty, sampler)
+	}
+
 	var config configuration
 	err := envconfig.Process("TRAIN", &config)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	var recovered backup
-
-	f, err := os.Open(config.Dump)
+	recovered, err := checkpoint.Load(config.Dump)
 	if err != nil {
-		log.Println(err)
-	}
-
-	dec := gob.NewDecoder(f)
-	err = dec.Decode(&recovered)
-	if err != nil {
-		log.Println(err)
+		log.Fatal(err)
 	}
 
 	model := recovered.Model
-	vocab := recovered.Vocabulary
+	vocab := NewVocabFromInference(recovered.Vocabulary)
 
-	args := os.Args[1:]
-	prompt := ""
-	for _, arg := range args {
-		prompt += arg + " "
+	prompt := strings.Join(flag.Args(), " ")
+	if *qaFormat {
+		prompt += " " + qa.Separator
 	}
 
-	prompt = strings.TrimRight(prompt, " ")
-
 	fmt.Println("Prompt:", prompt)
 	// fmt.Printf("Vocabulary: %v\n", vocab.Size())
 
 	parts := strings.Fields(prompt)
-	for _, r := range parts {
-	    _, err := vocab.TokenToIdx(r)
+	promptIdx := make([]int, len(parts))
+	for i, r := range parts {
+	    idx, err := vocab.TokenToIdx(r)
 
 	    if err != nil {
 		panic("Please use a prompt with known vocabulary characters")
 	    }
+	    promptIdx[i] = idx
 	}
 
 	vocabSize := vocab.Size()
 
-	prediction := char.NewPrediction(prompt, vocab.TokenToIdx, 100, vocabSize)
+	if *beamWidth > 0 {
+		var eos []int
+		for _, tk := range []string{"\n", char.EndOfSequence} {
+			if idx, err := vocab.TokenToIdx(tk); err == nil {
+				eos = append(eos, idx)
+			}
+		}
+		hypotheses, err := model.BeamSearch(context.TODO(), promptIdx, lstm.BeamConfig{
+			Width:         *beamWidth,
+			NBest:         *nBest,
+			MaxLength:     100,
+			EOS:           eos,
+			LengthPenalty: *lengthPenalty,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, h := range hypotheses {
+			answer := make([]string, 0, len(h.Tokens))
+			for _, idx := range h.Tokens {
+				rne, err := vocab.IdxToToken(idx)
+				if err != nil {
+					log.Fatal(err)
+				}
+				answer = append(answer, rne)
+			}
+			fmt.Printf("%.4f\t%v\n", h.Score, strings.Join(answer, " "))
+		}
+		return
+	}
+
+	prediction := char.NewPrediction(prompt, vocab.TokenToIdx, 100, vocabSize, char.WithSampler(sampler))
 
 	err = model.Predict(context.TODO(), prediction)
 	if err != nil {
@@ -82,6 +132,7 @@ func main() {
 
 	// fmt.Println("Prediction Size:", len(prediction.GetOutput()))
 
+	answer := make([]string, 0, len(prediction.GetOutput()))
 	for _, output := range prediction.GetOutput() {
 		var idx int
 		for i, val := range output {
@@ -93,9 +144,18 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
-		// fmt.Printf("%v\n", output)
-		fmt.Printf(string(rne))
+		answer = append(answer, rne)
+	}
+	if *verbose {
+		for i, score := range prediction.GetScores() {
+			fmt.Printf("%v\tp=%.4f\tH=%.4f\n", answer[i], score.Probability, score.Entropy)
+		}
+	}
+	fmt.Printf("Confidence: %.4f (log-likelihood %.4f)\n", prediction.Confidence(), prediction.LogLikelihood())
+	if prediction.Confidence() < *minConfidence {
+		fmt.Println(*fallback)
+		return
 	}
-	fmt.Println("")
+	fmt.Println(strings.Join(answer, " "))
 	
 }
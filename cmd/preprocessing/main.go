@@ -60,6 +60,7 @@ func init() {
 func main() {
     input := flag.String("i", "qa.csv", "input file name")
     output := flag.String("o", "qa.txt", "output file name")
+    seed := flag.Int64("seed", 1, "seed of the shuffling of the pairs")
     flag.Parse()
     trainPercent := 80.0
     // testPercent := 20
@@ -147,7 +148,7 @@ func main() {
     records, _ := reader.ReadAll()
 
     recordsLength := len(records)
-    shuffledRecords := rand.Perm(recordsLength)
+    shuffledRecords := rand.New(rand.NewSource(*seed)).Perm(recordsLength)
 
     f, err = os.Create("dataset/output/" + *output)
     if err != nil {
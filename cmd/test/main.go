@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"encoding/gob"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -10,9 +10,10 @@ import (
 	"strings"
 
 	"github.com/kelseyhightower/envconfig"
-	"github.com/owulveryck/lstm"
 	"github.com/owulveryck/lstm/datasetter/char"
+	"github.com/owulveryck/lstm/datasetter/qa"
 
+	"github.com/fahri-r/iteung-go/checkpoint"
 	."github.com/fahri-r/iteung-go/vocab"
 
 	"github.com/adrg/strutil"
@@ -23,36 +24,26 @@ type configuration struct {
 	Dump string `envconfig:"dump" default:"checkpoint.bin"`
 }
 
-type backup struct {
-	Model      lstm.Model
-	Vocabulary Vocabulary[string, int]
-}
-
 func main() {
 	
 	// efore we brt we bus repetition. the superfluity say, he catunt thones not urfeits, er abe can bust ne
 
+	qaFormat := flag.Bool("qa", false, "end the questions with the separator of a model trained on question and answer pairs")
+	flag.Parse()
+
 	var config configuration
 	err := envconfig.Process("TRAIN", &config)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	var recovered backup
-
-	f, err := os.Open(config.Dump)
+	recovered, err := checkpoint.Load(config.Dump)
 	if err != nil {
-		log.Println(err)
-	}
-
-	dec := gob.NewDecoder(f)
-	err = dec.Decode(&recovered)
-	if err != nil {
-		log.Println(err)
+		log.Fatal(err)
 	}
 
 	model := recovered.Model
-	vocab := recovered.Vocabulary
+	vocab := NewVocabFromInference(recovered.Vocabulary)
 
 	
     data, err := ioutil.ReadFile("dataset/output/test_qa.txt")
@@ -92,7 +83,11 @@ func main() {
 
 		vocabSize := vocab.Size()
 
-		prediction := char.NewPrediction(question, vocab.TokenToIdx, 100, vocabSize)
+		prompt := question
+		if *qaFormat {
+			prompt += " " + qa.Separator
+		}
+		prediction := char.NewPrediction(prompt, vocab.TokenToIdx, 100, vocabSize)
 
 		err = model.Predict(context.TODO(), prediction)
 		if err != nil {
@@ -117,11 +112,12 @@ func main() {
 			answer += strings.TrimSpace(string(rne)) + " "
 		}
 		fmt.Println(strings.TrimSpace(answer))
+		fmt.Printf("Confidence: %f\n", prediction.Confidence())
 
 		accuracy := strutil.Similarity(questionAnswerRecords[1], strings.TrimSpace(answer), metrics.NewJaroWinkler())
 		totalAccuracyInFloat += accuracy
 		
-		_, err := resultFile.WriteString(fmt.Sprintf("%s\n%s %f\n\n", strings.TrimSpace(question), strings.TrimSpace(answer), accuracy))
+		_, err := resultFile.WriteString(fmt.Sprintf("%s\n%s %f %f\n\n", strings.TrimSpace(question), strings.TrimSpace(answer), accuracy, prediction.Confidence()))
 
 		if err != nil {
 			log.Fatal(err)
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/owulveryck/lstm"
+	"github.com/owulveryck/lstm/datasetter/char"
+	G "gorgonia.org/gorgonia"
+
+	"github.com/fahri-r/iteung-go/checkpoint"
+)
+
+// trainConfig is the configuration of a training. The defaults are overridden by the configuration
+// of the resumed checkpoint, then by the JSON file given by -config, then by the flags of the command line
+type trainConfig struct {
+	// Seed seeds the initial weights, the shuffling and the samplers, so two runs are identical
+	Seed       int64            `json:"seed"`
+	Data       dataConfig       `json:"data"`
+	Model      modelConfig      `json:"model"`
+	Solver     solverConfig     `json:"solver"`
+	Schedule   scheduleConfig   `json:"schedule"`
+	Evaluation evaluationConfig `json:"evaluation"`
+	Metrics    metricsConfig    `json:"metrics"`
+	// Checkpoint is the file the best model is saved to
+	Checkpoint string `json:"checkpoint"`
+	// ResumeCheckpoint is the file an interrupted training and the checkpoints asked on the dashboard
+	// are saved to, so they never replace the best model. It is Checkpoint followed by .last if empty
+	ResumeCheckpoint string `json:"resume_checkpoint"`
+	// Resume is the checkpoint the training continues from
+	Resume string `json:"resume"`
+	// Dashboard is the address the dashboard is served on, none if empty
+	Dashboard string `json:"dashboard"`
+}
+
+type dataConfig struct {
+	Dir        string `json:"dir"`
+	Train      string `json:"train"`
+	Validation string `json:"validation"`
+	QA         bool   `json:"qa"`
+	Window     int    `json:"window"`
+	Stride     int    `json:"stride"`
+	Pairs      bool   `json:"pairs"`
+	Shuffle    bool   `json:"shuffle"`
+	Bucket     bool   `json:"bucket"`
+}
+
+type modelConfig struct {
+	HiddenSize int    `json:"hidden_size"`
+	BatchSize  int    `json:"batch_size"`
+	Epochs     int    `json:"epochs"`
+	State      string `json:"state"`
+	// the initializers of the weights: gaussian, glorot, he or orthogonal
+	InputInit     string  `json:"input_init"`
+	RecurrentInit string  `json:"recurrent_init"`
+	OutputInit    string  `json:"output_init"`
+	ForgetBias    float64 `json:"forget_bias"`
+	// the probabilities of dropping the units during the training
+	InputDropout     float64 `json:"input_dropout"`
+	RecurrentDropout float64 `json:"recurrent_dropout"`
+	OutputDropout    float64 `json:"output_dropout"`
+}
+
+type solverConfig struct {
+	Type      string  `json:"type"`
+	LearnRate float64 `json:"learn_rate"`
+	L2Reg     float64 `json:"l2_reg"`
+	Clip      float64 `json:"clip"`
+	ClipNorm  float64 `json:"clip_norm"`
+}
+
+type scheduleConfig struct {
+	Type     string  `json:"type"`
+	Decay    float64 `json:"decay"`
+	Every    int     `json:"every"`
+	Min      float64 `json:"min"`
+	Patience int     `json:"patience"`
+	Warmup   int     `json:"warmup"`
+}
+
+type evaluationConfig struct {
+	ValidateEvery int      `json:"validate_every"`
+	Patience      int      `json:"patience"`
+	LogEvery      int      `json:"log_every"`
+	SampleEvery   int      `json:"sample_every"`
+	SampleLength  int      `json:"sample_length"`
+	Prompts       []string `json:"prompts"`
+	// Sampler picks the tokens of the samples: greedy, temperature, topk or topp
+	Sampler     string  `json:"sampler"`
+	Temperature float64 `json:"temperature"`
+	TopK        int     `json:"top_k"`
+	TopP        float64 `json:"top_p"`
+}
+
+// metricsConfig tells where the measures of the training are written, at every log and evaluation
+type metricsConfig struct {
+	// File is a CSV file if its extension is .csv, a JSON lines file otherwise
+	File        string `json:"file"`
+	TensorBoard string `json:"tensorboard"`
+}
+
+func defaultConfig(dump string) trainConfig {
+	return trainConfig{
+		Seed: 1,
+		Data: dataConfig{
+			Dir:    "dataset/output",
+			Train:  "train_qa.txt",
+			Window: 30,
+			Stride: 1,
+		},
+		Model: modelConfig{
+			HiddenSize:    100,
+			BatchSize:     1,
+			Epochs:        10,
+			State:         "reset",
+			InputInit:     "gaussian",
+			RecurrentInit: "gaussian",
+			OutputInit:    "gaussian",
+		},
+		Solver: solverConfig{
+			Type:      "rmsprop",
+			LearnRate: 1e-3,
+			L2Reg:     1e-6,
+			Clip:      5,
+		},
+		Schedule: scheduleConfig{
+			Type:     "none",
+			Decay:    0.5,
+			Every:    1000,
+			Patience: 2,
+		},
+		Evaluation: evaluationConfig{
+			ValidateEvery: 500,
+			Patience:      5,
+			LogEvery:      100,
+			SampleEvery:   500,
+			SampleLength:  100,
+			Prompts:       []string{"siang"},
+			Sampler:       "greedy",
+			Temperature:   1,
+			TopK:          10,
+			TopP:          0.9,
+		},
+		Checkpoint: dump,
+	}
+}
+
+// promptsFlag replaces the prompts of the configuration by the ones of the command line
+type promptsFlag struct {
+	prompts *[]string
+	set     bool
+}
+
+func (p *promptsFlag) String() string {
+	if p.prompts == nil {
+		return ""
+	}
+	return strings.Join(*p.prompts, ", ")
+}
+
+func (p *promptsFlag) Set(prompt string) error {
+	if !p.set {
+		*p.prompts = nil
+		p.set = true
+	}
+	*p.prompts = append(*p.prompts, prompt)
+	return nil
+}
+
+// flagSet binds the flags of the command line to c; file receives the path of the configuration file
+func (c *trainConfig) flagSet(file *string) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.StringVar(file, "config", "", "JSON configuration file, overridden by the flags")
+	fs.StringVar(&c.Checkpoint, "checkpoint", c.Checkpoint, "file the best model is saved to")
+	fs.StringVar(&c.ResumeCheckpoint, "resume-checkpoint", c.ResumeCheckpoint, "file an interrupted training and the checkpoints asked on the dashboard are saved to; the checkpoint file followed by .last if empty")
+	fs.StringVar(&c.Resume, "resume", c.Resume, "checkpoint to resume the training from; its configuration is the default one")
+	fs.Int64Var(&c.Seed, "seed", c.Seed, "seed of the initial weights, the shuffling and the samplers")
+	fs.StringVar(&c.Dashboard, "dashboard", c.Dashboard, "address the dashboard following the training is served on, such as :8080; it is served on 127.0.0.1 unless a host is given")
+
+	fs.StringVar(&c.Data.Dir, "data-dir", c.Data.Dir, "directory of the training and validation files")
+	fs.StringVar(&c.Data.Train, "i", c.Data.Train, "input file name")
+	fs.StringVar(&c.Data.Validation, "validation", c.Data.Validation, "held-out file evaluated during the training; the best model is saved and the training stops early")
+	fs.BoolVar(&c.Data.QA, "qa", c.Data.QA, "train on question <sep> answer <eos> sequences and only learn the answers")
+	fs.IntVar(&c.Data.Window, "window", c.Data.Window, "number of tokens of a training sequence")
+	fs.IntVar(&c.Data.Stride, "stride", c.Data.Stride, "number of tokens between the starts of two training sequences")
+	fs.BoolVar(&c.Data.Pairs, "pairs", c.Data.Pairs, "never let a training sequence cross the blank line between two pairs")
+	fs.BoolVar(&c.Data.Shuffle, "shuffle", c.Data.Shuffle, "shuffle the training sequences at every epoch")
+	fs.BoolVar(&c.Data.Bucket, "bucket", c.Data.Bucket, "batch together the training sequences of similar lengths")
+
+	fs.IntVar(&c.Model.HiddenSize, "hidden", c.Model.HiddenSize, "size of the memory of the model")
+	fs.IntVar(&c.Model.BatchSize, "batch", c.Model.BatchSize, "number of sequences per training step")
+	fs.IntVar(&c.Model.Epochs, "epochs", c.Model.Epochs, "number of times the training file is read")
+	fs.StringVar(&c.Model.State, "state", c.Model.State, "memory at the start of a training step: reset, carry (the sequences must be contiguous: -batch 1 and -stride of -window minus 1, without -shuffle, -pairs or -qa) or eos (reset after the end of a pair)")
+
+	fs.StringVar(&c.Model.InputInit, "input-init", c.Model.InputInit, "initializer of the input weights of the gates: gaussian, glorot, he or orthogonal")
+	fs.StringVar(&c.Model.RecurrentInit, "recurrent-init", c.Model.RecurrentInit, "initializer of the recurrent weights of the gates: gaussian, glorot, he or orthogonal")
+	fs.StringVar(&c.Model.OutputInit, "output-init", c.Model.OutputInit, "initializer of the output weights: gaussian, glorot, he or orthogonal")
+	fs.Float64Var(&c.Model.ForgetBias, "forget-bias", c.Model.ForgetBias, "initial bias of the forget gate")
+	fs.Float64Var(&c.Model.InputDropout, "input-dropout", c.Model.InputDropout, "probability of dropping an input of the cell during the training")
+	fs.Float64Var(&c.Model.RecurrentDropout, "recurrent-dropout", c.Model.RecurrentDropout, "probability of dropping a unit of the memory entering the gates, with one mask per sequence")
+	fs.Float64Var(&c.Model.OutputDropout, "output-dropout", c.Model.OutputDropout, "probability of dropping a unit of the memory before the output layer")
+
+	fs.StringVar(&c.Solver.Type, "solver", c.Solver.Type, "solver: rmsprop, adam, adamw, momentum, adagrad or sgd")
+	fs.Float64Var(&c.Solver.LearnRate, "lr", c.Solver.LearnRate, "learn rate of the solver")
+	fs.Float64Var(&c.Solver.L2Reg, "l2", c.Solver.L2Reg, "L2 regularization of the solver (0 disables it)")
+	fs.Float64Var(&c.Solver.Clip, "clip", c.Solver.Clip, "largest absolute value of a gradient element (0 disables it)")
+	fs.Float64Var(&c.Solver.ClipNorm, "clip-norm", c.Solver.ClipNorm, "largest global L2 norm of the gradients, they are rescaled together above it (0 never rescales)")
+
+	fs.StringVar(&c.Schedule.Type, "schedule", c.Schedule.Type, "learn rate schedule: none, step, exp, cosine or plateau (reduced when the validation loss stops decreasing)")
+	fs.Float64Var(&c.Schedule.Decay, "lr-decay", c.Schedule.Decay, "factor the learn rate is multiplied by at every decay of the schedule")
+	fs.IntVar(&c.Schedule.Every, "lr-every", c.Schedule.Every, "number of steps between two decays of the step schedule, or period of the cosine schedule")
+	fs.Float64Var(&c.Schedule.Min, "lr-min", c.Schedule.Min, "lowest learn rate of the cosine and plateau schedules")
+	fs.IntVar(&c.Schedule.Patience, "lr-patience", c.Schedule.Patience, "number of evaluations without improvement before the plateau schedule reduces the learn rate")
+	fs.IntVar(&c.Schedule.Warmup, "warmup", c.Schedule.Warmup, "number of steps the learn rate linearly increases to its value")
+
+	fs.IntVar(&c.Evaluation.ValidateEvery, "validate-every", c.Evaluation.ValidateEvery, "number of training steps between two evaluations of the validation file")
+	fs.IntVar(&c.Evaluation.Patience, "patience", c.Evaluation.Patience, "number of evaluations without improvement before stopping the training (0 never stops)")
+	fs.IntVar(&c.Evaluation.LogEvery, "log-every", c.Evaluation.LogEvery, "number of training steps between two logs of the cost (0 never logs)")
+	fs.IntVar(&c.Evaluation.SampleEvery, "sample-every", c.Evaluation.SampleEvery, "number of training steps between two samples of the prompts (0 never samples)")
+	fs.IntVar(&c.Evaluation.SampleLength, "sample-length", c.Evaluation.SampleLength, "number of tokens of a sample")
+	fs.StringVar(&c.Evaluation.Sampler, "sampler", c.Evaluation.Sampler, "sampling strategy of the samples: greedy, temperature, topk or topp")
+	fs.Float64Var(&c.Evaluation.Temperature, "temperature", c.Evaluation.Temperature, "temperature of the temperature, topk and topp samplers")
+	fs.IntVar(&c.Evaluation.TopK, "k", c.Evaluation.TopK, "number of candidates of the topk sampler")
+	fs.Float64Var(&c.Evaluation.TopP, "p", c.Evaluation.TopP, "cumulative probability of the topp sampler")
+	fs.StringVar(&c.Metrics.File, "metrics", c.Metrics.File, "file the measures of the training are written to, as CSV if it ends with .csv, as JSON lines otherwise; a resumed training appends to it")
+	fs.StringVar(&c.Metrics.TensorBoard, "tensorboard", c.Metrics.TensorBoard, "directory of the TensorBoard event file the measures of the training are written to")
+	fs.Var(&promptsFlag{prompts: &c.Evaluation.Prompts}, "prompt", "prompt sampled during the training, repeat the flag for several prompts")
+	return fs
+}
+
+// loadConfig resolves the configuration of the training from the command line arguments.
+// dump is the default checkpoint file
+func loadConfig(args []string, dump string) (trainConfig, error) {
+	// the first pass finds the configuration file and the resumed checkpoint
+	first := defaultConfig(dump)
+	var file string
+	if err := first.flagSet(&file).Parse(args); err != nil {
+		return first, err
+	}
+
+	c := defaultConfig(dump)
+	if first.Resume != "" {
+		h, err := checkpoint.ReadHeader(first.Resume)
+		if err != nil {
+			return c, err
+		}
+		if len(h.Config) > 0 {
+			if err := json.Unmarshal(h.Config, &c); err != nil {
+				return c, fmt.Errorf("cannot read the configuration of %v: %v", first.Resume, err)
+			}
+		}
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return c, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			return c, fmt.Errorf("cannot read the configuration file %v: %v", file, err)
+		}
+	}
+	// the flags set on the command line override the configuration
+	if err := c.flagSet(&file).Parse(args); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// resumeCheckpoint returns the file an interrupted training is saved to
+func (c trainConfig) resumeCheckpoint() string {
+	if c.ResumeCheckpoint != "" {
+		return c.ResumeCheckpoint
+	}
+	return c.Checkpoint + ".last"
+}
+
+// modelOpts returns the options of a new model: its seed and the initialization of its weights
+func (c trainConfig) modelOpts() ([]lstm.ModelOpt, error) {
+	initializer := func(name string) (lstm.Initializer, error) {
+		switch name {
+		case "gaussian":
+			return lstm.Gaussian(0, 0.08), nil
+		case "glorot":
+			return lstm.GlorotNormal(1), nil
+		case "he":
+			return lstm.HeNormal(1), nil
+		case "orthogonal":
+			return lstm.Orthogonal(1), nil
+		}
+		return nil, fmt.Errorf("unknown initializer %v", name)
+	}
+	input, err := initializer(c.Model.InputInit)
+	if err != nil {
+		return nil, err
+	}
+	recurrent, err := initializer(c.Model.RecurrentInit)
+	if err != nil {
+		return nil, err
+	}
+	output, err := initializer(c.Model.OutputInit)
+	if err != nil {
+		return nil, err
+	}
+	return []lstm.ModelOpt{
+		lstm.WithSeed(c.Seed),
+		lstm.WithInputInit(input),
+		lstm.WithRecurrentInit(recurrent),
+		lstm.WithOutputInit(output),
+		lstm.WithForgetBias(float32(c.Model.ForgetBias)),
+	}, nil
+}
+
+// newSolver returns the solver of the configuration, wrapped by its learn rate schedule and by the gradient clipper
+func (c trainConfig) newSolver() (G.StatefulSolver, error) {
+	opts := []G.SolverOpt{G.WithLearnRate(c.Solver.LearnRate)}
+	if c.Solver.L2Reg > 0 {
+		opts = append(opts, G.WithL2Reg(c.Solver.L2Reg))
+	}
+	if c.Solver.Clip > 0 {
+		opts = append(opts, G.WithClip(c.Solver.Clip))
+	}
+	var solver G.StatefulSolver
+	switch c.Solver.Type {
+	case "rmsprop":
+		solver = G.NewRMSPropSolver(opts...)
+	case "adam":
+		solver = G.NewAdamSolver(opts...)
+	case "adamw":
+		solver = G.NewAdamW(opts...)
+	case "momentum":
+		solver = G.NewMomentum(opts...)
+	case "adagrad":
+		solver = G.NewAdaGradSolver(opts...)
+	case "sgd":
+		solver = G.NewVanillaSolver(opts...)
+	default:
+		return nil, fmt.Errorf("unknown solver %v", c.Solver.Type)
+	}
+
+	s := c.Schedule
+	var schedule G.Schedule
+	switch s.Type {
+	case "none":
+	case "step":
+		schedule = G.NewStepDecay(s.Every, s.Decay)
+	case "exp":
+		schedule = G.NewExponentialDecay(s.Decay)
+	case "cosine":
+		schedule = G.NewCosineAnnealing(s.Every, 1, s.Min)
+	case "plateau":
+		if c.Data.Validation == "" {
+			return nil, fmt.Errorf("the plateau schedule needs a validation file")
+		}
+		schedule = G.NewReduceOnPlateau(s.Decay, s.Patience, s.Min)
+	default:
+		return nil, fmt.Errorf("unknown learn rate schedule %v", s.Type)
+	}
+	if s.Warmup > 0 {
+		schedule = G.NewLinearWarmup(s.Warmup, schedule)
+	}
+	if schedule != nil {
+		scheduler, err := G.NewScheduler(solver, schedule)
+		if err != nil {
+			return nil, err
+		}
+		solver = scheduler
+	}
+	// the clipper also reports the norms of the gradients
+	return G.NewGlobalNormClipper(solver, c.Solver.ClipNorm), nil
+}
+
+// newSampler returns the sampler of the samples, the random ones draw from the seed of the configuration
+func (c trainConfig) newSampler() (char.Sampler, error) {
+	e := c.Evaluation
+	switch e.Sampler {
+	case "greedy":
+		return char.NewGreedySampler(), nil
+	case "temperature":
+		return char.NewTemperatureSampler(e.Temperature, char.NewRand(c.Seed)), nil
+	case "topk":
+		return char.NewTopKSampler(e.TopK, e.Temperature, char.NewRand(c.Seed)), nil
+	case "topp":
+		return char.NewTopPSampler(e.TopP, e.Temperature, char.NewRand(c.Seed)), nil
+	}
+	return nil, fmt.Errorf("unknown sampler %v", e.Sampler)
+}
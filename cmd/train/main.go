@@ -2,22 +2,34 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
-	"encoding/gob"
+	"errors"
 	"fmt"
 	"io"
 	_"io/ioutil"
-	"flag"
+	"encoding/json"
 	"log"
+	"math"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	"strings"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/owulveryck/lstm"
+	"github.com/owulveryck/lstm/datasetter"
 	"github.com/owulveryck/lstm/datasetter/char"
+	"github.com/owulveryck/lstm/datasetter/qa"
 	G "gorgonia.org/gorgonia"
 
+	"github.com/fahri-r/iteung-go/checkpoint"
+	"github.com/fahri-r/iteung-go/dashboard"
+	"github.com/fahri-r/iteung-go/metrics"
 	."github.com/fahri-r/iteung-go/vocab"
 )
 
@@ -25,7 +37,7 @@ type configuration struct {
 	Dump string `envconfig:"dump" default:"checkpoint.bin"`
 }
 
-func newVocabulary(filename string) (*Vocabulary[string, int], error) {
+func newVocabulary(filename string, qaTokens bool) (*Vocabulary[string, int], error) {
 
 	v := NewVocabStructure[string, int]()
 
@@ -76,13 +88,46 @@ func newVocabulary(filename string) (*Vocabulary[string, int], error) {
 	    }
 	}
 
+	// tokens framing the answers of the question and answer training set, after the ones of the corpus
+	// so the indices of a vocabulary built without them are kept
+	if qaTokens {
+		for _, tk := range []string{qa.Separator, char.EndOfSequence} {
+			if _, exists := v.Get(tk); !exists {
+				v.Insert(tk, id)
+				id++
+			}
+		}
+	}
+
 	return v, nil
 
 }
 
-type backup struct {
-	Model      lstm.Model
-	Vocabulary InferenceVocabulary[string, int]
+// gradient norms outside of these bounds are reported
+const (
+	vanishingNorm = 1e-7
+	explodingNorm = 1e3
+)
+
+// checkGradients logs the parameters whose gradients vanish or explode
+func checkGradients(stats G.GradStats) {
+	for name, norm := range stats.Norms {
+		switch {
+		case norm < vanishingNorm:
+			log.Printf("the gradient of %v is vanishing (norm %v)", name, norm)
+		case norm > explodingNorm:
+			log.Printf("the gradient of %v is exploding (norm %v)", name, norm)
+		}
+	}
+}
+
+// trainingSet is a dataset that can be read again at every epoch
+type trainingSet interface {
+	datasetter.FullTrainer
+	Rewind()
+	Epoch() int
+	Position() (int, int)
+	Seek(epoch, offset int) error
 }
 
 func main() {
@@ -93,12 +138,20 @@ func main() {
 		log.Fatal(err)
 	}
 
-    filename := flag.String("i", "train_qa.txt", "input file name")
-	flag.Parse()
+	cfg, err := loadConfig(os.Args[1:], config.Dump)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the resolved configuration is saved in the checkpoints
+	resolved, err := json.Marshal(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Configuration: %s\n", resolved)
 
 	// Read the file
-	
-	vocab, err := newVocabulary("dataset/output/" + *filename)
+	trainFile := filepath.Join(cfg.Data.Dir, cfg.Data.Train)
+	vocab, err := newVocabulary(trainFile, cfg.Data.QA)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -110,115 +163,376 @@ func main() {
 
 	fmt.Printf("Vocabulary: %v\n", vocab.Size())
 
-	// os.Exit(0)
-
-	// TRAINING ARGUMENTS
-	prompt := "siang"
-	iter := 10
+	prompts := cfg.Evaluation.Prompts
+	if cfg.Data.QA {
+		prompts = make([]string, len(cfg.Evaluation.Prompts))
+		for i, prompt := range cfg.Evaluation.Prompts {
+			prompts[i] = prompt + " " + qa.Separator
+		}
+	}
 
 	vocabSize := vocab.Size()
-	model := lstm.NewModel(vocabSize, vocabSize, 100)
+	modelOpts, err := cfg.modelOpts()
+	if err != nil {
+		log.Fatal(err)
+	}
+	model := lstm.NewModel(vocabSize, vocabSize, cfg.Model.HiddenSize, modelOpts...)
 
-	learnrate := 1e-3
-	l2reg := 1e-6
-	clipVal := float64(5)
-	solver := G.NewRMSPropSolver(G.WithLearnRate(learnrate), G.WithL2Reg(l2reg), G.WithClip(clipVal))
+	solver, err := cfg.newSolver()
+	if err != nil {
+		log.Fatal(err)
+	}
+	sampler, err := cfg.newSampler()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	for i := 0; i < iter; i++ {
-		f, err := os.Open("dataset/output/" + *filename)
+	seed := cfg.Seed
+	var resumed *checkpoint.Resume
+	if cfg.Resume != "" {
+		ckpt, err := checkpoint.Load(cfg.Resume)
 		if err != nil {
 			log.Fatal(err)
 		}
-		max, _ := f.Seek(0, io.SeekEnd)
-		
-		f.Seek(0, io.SeekStart)
-		
-		fmt.Println("Preparing dataset...")
-
-		tset := char.NewTrainingSet(f, vocab.TokenToIdx, vocab.IdxToToken, vocabSize, 30, 1)
-		pause := make(chan struct{})
-		infoChan, errc := model.Train(context.TODO(), tset, solver, pause)
-		iter := 1
-		var minLoss float32
-		
-		fmt.Printf("Starting training (%v)...\n", i)
-
-		for infos := range infoChan {
-			if iter%100 == 0 {
-				if minLoss == 0 {
-					minLoss = infos.Cost
-				}
-				if infos.Cost < minLoss {
-					minLoss = infos.Cost
-					log.Println("Backup because loss is minimum")
+		if err := ckpt.Header.Compatible(model.Config(), *NewInferenceVocabFromExsting(*vocab)); err != nil {
+			log.Fatal(err)
+		}
+		model = ckpt.Model
+		resumed = ckpt.Resume
+		if resumed == nil {
+			log.Printf("%v holds no training state, only the weights are restored", cfg.Resume)
+		} else {
+			if err := solver.SetState(resumed.Solver); err != nil {
+				log.Fatal(err)
+			}
+			// the epochs are shuffled as in the interrupted training
+			seed = resumed.Seed
+			fmt.Printf("Resuming the training at step %v (epoch %v)\n", resumed.Training.Step, resumed.Training.Epoch)
+		}
+	}
 
-					infVocab := NewInferenceVocabFromExsting(*vocab)
+	trainOpts := []lstm.TrainOpt{
+		lstm.WithBatchSize(cfg.Model.BatchSize),
+		lstm.WithDropout(lstm.Dropout{
+			Input:     cfg.Model.InputDropout,
+			Recurrent: cfg.Model.RecurrentDropout,
+			Output:    cfg.Model.OutputDropout,
+		}),
+	}
+	switch cfg.Model.State {
+	case "carry":
+		// the memory of a step is only meaningful at the start of the next sequence if it continues the previous one
+		if cfg.Model.BatchSize != 1 || cfg.Data.Stride != cfg.Data.Window-1 || cfg.Data.Shuffle || cfg.Data.Pairs || cfg.Data.QA {
+			log.Fatal("the carry state policy needs contiguous sequences: -batch 1 and a -stride of -window minus 1, without -shuffle, -pairs or -qa")
+		}
+		trainOpts = append(trainOpts, lstm.WithStatePolicy(lstm.CarryState))
+	case "reset":
+		trainOpts = append(trainOpts, lstm.WithStatePolicy(lstm.ResetState))
+	case "eos":
+		var eos []int
+		for _, tk := range []string{"\n", char.EndOfSequence} {
+			if idx, err := vocab.TokenToIdx(tk); err == nil {
+				eos = append(eos, idx)
+			}
+		}
+		trainOpts = append(trainOpts, lstm.WithStatePolicy(lstm.ResetAtEOS, eos...))
+	default:
+		log.Fatalf("unknown state policy %v", cfg.Model.State)
+	}
 
-					bkp := backup{
-						Model:      *model,
-						Vocabulary: *infVocab,
-					}
-					f, err := os.OpenFile(config.Dump, os.O_RDWR|os.O_CREATE, 0755)
-					if err != nil {
-						log.Println(err)
-					}
-					enc := gob.NewEncoder(f)
-					err = enc.Encode(bkp)
-					if err != nil {
-						log.Println(err)
-					}
-					if err := f.Close(); err != nil {
-						log.Println(err)
-					}
-				}
-				here, _ := f.Seek(0, io.SeekCurrent)
-				
-				fmt.Printf("[%v/%v]%v\n", here, max, infos)
+	// newSet reads a training set; the validation set is never shuffled
+	newSet := func(data []byte, shuffled bool) (trainingSet, error) {
+		r := bytes.NewReader(data)
+		if cfg.Data.QA {
+			var qaOpts []qa.TrainingSetOpt
+			if shuffled {
+				qaOpts = append(qaOpts, qa.WithShuffle(seed))
+			}
+			return qa.NewTrainingSet(r, vocab.TokenToIdx, vocabSize, qaOpts...)
+		}
+		var tsetOpts []char.TrainingSetOpt
+		if cfg.Data.Pairs {
+			tsetOpts = append(tsetOpts, char.WithPairs())
+		}
+		if shuffled {
+			tsetOpts = append(tsetOpts, char.WithShuffle(seed))
+		}
+		if cfg.Data.Bucket {
+			tsetOpts = append(tsetOpts, char.WithBucketing())
+		}
+		tset := char.NewTrainingSet(r, vocab.TokenToIdx, vocab.IdxToToken, vocabSize, cfg.Data.Window, cfg.Data.Stride, tsetOpts...)
+		if tset == nil {
+			return nil, errors.New("the dataset holds a token out of the vocabulary")
+		}
+		return tset, nil
+	}
 
-				// if here >= max {
-				//     pause <- 1
-				// }
+	fmt.Println("Preparing dataset...")
+	data, err := os.ReadFile(trainFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tset, err := newSet(data, cfg.Data.Shuffle)
+	if err != nil {
+		log.Fatal(err)
+	}
+	trainOpts = append(trainOpts, lstm.WithEpochs(cfg.Model.Epochs))
+	if resumed != nil {
+		if err := tset.Seek(resumed.DatasetEpoch, resumed.DatasetOffset); err != nil {
+			log.Fatal(err)
+		}
+		trainOpts = append(trainOpts, lstm.WithResume(resumed.Training))
+	}
+	if cfg.Data.Validation != "" {
+		validationData, err := os.ReadFile(filepath.Join(cfg.Data.Dir, cfg.Data.Validation))
+		if err != nil {
+			log.Fatal(err)
+		}
+		trainOpts = append(trainOpts, lstm.WithValidation(func() (datasetter.FullTrainer, error) {
+			return newSet(validationData, false)
+		}, cfg.Evaluation.ValidateEvery, cfg.Evaluation.Patience))
+	}
+
+	// save is called by the hooks of the trainer, between two steps, so the weights, the solver
+	// and the training set are saved to path as they are after the step of infos
+	save := func(path string, infos lstm.TrainingInfos) error {
+		solverState, err := solver.State()
+		if err != nil {
+			return err
+		}
+		datasetEpoch := tset.Epoch()
+		datasetOffset, _ := tset.Position()
+		measures := map[string]float64{
+			"cost":       float64(infos.Cost),
+			"perplexity": math.Exp(float64(infos.Cost)),
+		}
+		if infos.Validated {
+			measures["validation_loss"] = float64(infos.ValidationLoss)
+			measures["validation_perplexity"] = float64(infos.ValidationPerplexity)
+		}
+		return checkpoint.Save(path, &checkpoint.Checkpoint{
+			Header: checkpoint.Header{
+				Step:    infos.Step,
+				Epoch:   infos.Epoch,
+				Metrics: measures,
+				Config:  resolved,
+			},
+			Model:      model,
+			Vocabulary: *NewInferenceVocabFromExsting(*vocab),
+			Resume: &checkpoint.Resume{
+				Training:      infos.State,
+				Solver:        solverState,
+				DatasetEpoch:  datasetEpoch,
+				DatasetOffset: datasetOffset,
+				Seed:          seed,
+			},
+		})
+	}
 
+	// Ctrl-C or SIGTERM stops the training after the current step and saves it; a second signal kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	var sinks []metrics.Sink
+	if cfg.Metrics.File != "" {
+		// the records of a resumed training follow the ones written before the interruption
+		open := metrics.Create
+		if resumed != nil {
+			open = metrics.Append
+		}
+		sink, err := open(cfg.Metrics.File)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.Metrics.TensorBoard != "" {
+		sink, err := metrics.NewEventFile(cfg.Metrics.TensorBoard)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, sink)
+	}
+	var dash *dashboard.Server
+	if cfg.Dashboard != "" {
+		dash = dashboard.New(resolved)
+		sinks = append(sinks, dash)
+		addr := dashboard.ListenAddr(cfg.Dashboard)
+		go func() {
+			log.Println(http.ListenAndServe(addr, dash))
+		}()
+		fmt.Printf("Dashboard on %v\n", dashboard.URL(addr))
+	}
+	sink := metrics.Multi(sinks...)
+
+	// generate samples the prompts with the model of step
+	generate := func(step int) error {
+		fmt.Println("\nGoing to predict")
+		for _, prompt := range prompts {
+			prediction := char.NewPrediction(prompt, vocab.TokenToIdx, cfg.Evaluation.SampleLength, vocabSize, char.WithSampler(sampler))
+			err := model.Predict(ctx, prediction)
+			if err != nil {
+				log.Println(err)
+				continue
 			}
-			if iter%500 == 0 {
-				fmt.Println("\nGoing to predict")
-				pause <- struct{}{}
-				prediction := char.NewPrediction(prompt, vocab.TokenToIdx, 100, vocabSize)
-				err := model.Predict(context.TODO(), prediction)
+
+			// the tokens are words, joined with spaces as cmd/inference does
+			answer := make([]string, 0, len(prediction.GetOutput()))
+			for _, output := range prediction.GetOutput() {
+				var idx int
+				for i, val := range output {
+					if val == 1 {
+						idx = i
+					}
+				}
+				rne, err := vocab.IdxToToken(idx)
 				if err != nil {
+					return err
+				}
+				answer = append(answer, rne)
+			}
+			text := strings.Join(answer, " ")
+			fmt.Printf("%v: %v\n", prompt, text)
+			if dash != nil {
+				dash.AddSample(dashboard.Sample{Step: step, Prompt: prompt, Text: text})
+			}
+		}
+		return nil
+	}
+	// done returns the fraction of the training already done
+	done := func() float64 {
+		here, max := tset.Position()
+		if max == 0 || cfg.Model.Epochs <= 0 {
+			return 0
+		}
+		return (float64(tset.Epoch()) + float64(here)/float64(max)) / float64(cfg.Model.Epochs)
+	}
+	progress := metrics.NewProgress(time.Now(), done())
+
+	trainer := lstm.NewTrainer(model, solver, trainOpts...)
+	var minLoss float32
+	trainer.OnStep(func(infos lstm.TrainingInfos) error {
+		progress.Add(infos.Tokens)
+		logged := cfg.Evaluation.LogEvery > 0 && infos.Step%cfg.Evaluation.LogEvery == 0
+		if !logged && !infos.Validated {
+			return nil
+		}
+		record := metrics.NewRecord(infos, time.Now())
+		progress.Measure(&record, done())
+		// the training goes on without its measures
+		if err := sink.Write(record); err != nil {
+			log.Println(err)
+		}
+		if !logged {
+			return nil
+		}
+		// without a validation set, the training loss is the only hint
+		if cfg.Data.Validation == "" {
+			if minLoss == 0 {
+				minLoss = infos.Cost
+			}
+			if infos.Cost < minLoss {
+				minLoss = infos.Cost
+				log.Println("Backup because loss is minimum")
+				if err := save(cfg.Checkpoint, infos); err != nil {
 					log.Println(err)
-					continue
 				}
-
-				for _, output := range prediction.GetOutput() {
-					var idx int
-					for i, val := range output {
-						if val == 1 {
-							idx = i
-						}
-					}
-					rne, err := vocab.IdxToToken(idx)
-					if err != nil {
-						log.Fatal(err)
+			}
+		}
+		fmt.Printf("[%.1f%%] step %v, epoch %v: cost %v, perplexity %v, learn rate %v, gradient norm %v, %.0f tokens/s, %v left\n",
+			100*done(), infos.Step, infos.Epoch, infos.Cost, record.Perplexity, infos.LearnRate, infos.Gradients.GlobalNorm,
+			record.TokensPerSec, (time.Duration(record.ETA) * time.Second).Round(time.Second))
+		checkGradients(infos.Gradients)
+		return nil
+	})
+	trainer.OnStep(func(infos lstm.TrainingInfos) error {
+		if cfg.Evaluation.SampleEvery <= 0 || infos.Step%cfg.Evaluation.SampleEvery != 0 {
+			return nil
+		}
+		return generate(infos.Step)
+	})
+	if dash != nil {
+		// the actions asked on the dashboard are performed between two steps
+		trainer.OnStep(func(infos lstm.TrainingInfos) error {
+			select {
+			case action := <-dash.Actions():
+				switch action {
+				case dashboard.CheckpointAction:
+					if err := save(cfg.resumeCheckpoint(), infos); err != nil {
+						log.Println(err)
+						dash.Notify(fmt.Sprintf("checkpoint failed: %v", err))
+						return nil
 					}
-					fmt.Printf(rne)
+					dash.Notify(fmt.Sprintf("checkpoint of step %v saved to %v", infos.Step, cfg.resumeCheckpoint()))
+				case dashboard.SampleAction:
+					return generate(infos.Step)
 				}
-				fmt.Println("")
-				pause <- struct{}{}
+			default:
 			}
-			iter++
+			return nil
+		})
+	}
+	trainer.OnEpochEnd(func(infos lstm.TrainingInfos) error {
+		fmt.Printf("Epoch %v done at step %v\n", infos.Epoch, infos.Step)
+		return nil
+	})
+	bestValidation := float32(-1)
+	trainer.OnEvaluate(func(infos lstm.TrainingInfos) error {
+		fmt.Printf("Validation at step %v: loss %v, perplexity %v\n", infos.Step, infos.ValidationLoss, infos.ValidationPerplexity)
+		if infos.Best {
+			bestValidation = infos.ValidationLoss
 		}
-		err = <-errc
-		if err == io.EOF {
-			close(pause)
-			//return
+		return nil
+	})
+	// the interrupted training is saved beside the best model, which is the one kept by cfg.Checkpoint
+	interruptSaved := false
+	trainer.OnCheckpoint(func(infos lstm.TrainingInfos) error {
+		path := cfg.Checkpoint
+		switch {
+		case infos.Interrupted:
+			path = cfg.resumeCheckpoint()
+			log.Printf("Interrupted at step %v, saving the training to %v", infos.Step, path)
+		case infos.Best:
+			log.Println("Backup because validation loss is minimum")
 		}
-		if err != nil && err != io.EOF {
-			log.Fatal(err)
+		if err := save(path, infos); err != nil {
+			log.Println(err)
+			return nil
 		}
-		f.Close()
+		interruptSaved = infos.Interrupted
+		return nil
+	})
+
+	fmt.Println("Starting training...")
+	started := time.Now()
+	last, err := trainer.Run(ctx, tset)
+	if err := sink.Close(); err != nil {
+		log.Println(err)
+	}
+	if err == lstm.ErrEarlyStop {
+		log.Println("Early stop:", err)
+	}
+	if err != nil && err != io.EOF && err != lstm.ErrEarlyStop {
+		log.Fatal(err)
 	}
 
+	fmt.Printf("Trained up to step %v (epoch %v) in %v: cost %v, perplexity %v\n",
+		last.Step, last.Epoch, time.Since(started).Round(time.Second), last.Cost, math.Exp(float64(last.Cost)))
+	if bestValidation >= 0 {
+		fmt.Printf("Lowest validation loss: %v\n", bestValidation)
+	}
+	if last.Interrupted {
+		if interruptSaved {
+			fmt.Printf("Interrupted, resume with -resume %v\n", cfg.resumeCheckpoint())
+		} else {
+			fmt.Println("Interrupted, the training could not be saved")
+		}
+		return
+	}
 	fmt.Println("Done")
 
-}
\ No newline at end of file
+}
@@ -0,0 +1,292 @@
+// Package dashboard serves a page following a training live: charts of the losses, the latest samples,
+// the configuration of the training, and buttons asking for a checkpoint or a sample.
+// The page is embedded and needs no external asset.
+package dashboard
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/fahri-r/iteung-go/metrics"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+const (
+	// maxRecords is the number of records a page gets when it is opened
+	maxRecords = 5000
+	// maxSamples is the number of samples kept
+	maxSamples = 20
+	// clientBuffer is the number of events waiting for a slow page before the next ones are dropped
+	clientBuffer = 64
+)
+
+// Action is asked by a page and performed by the training between two steps
+type Action int
+
+const (
+	// CheckpointAction saves the training
+	CheckpointAction Action = iota
+	// SampleAction generates the samples of the prompts
+	SampleAction
+)
+
+func (a Action) String() string {
+	switch a {
+	case CheckpointAction:
+		return "checkpoint"
+	case SampleAction:
+		return "sample"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// Sample is a text generated from a prompt during the training
+type Sample struct {
+	Step   int    `json:"step"`
+	Prompt string `json:"prompt"`
+	Text   string `json:"text"`
+}
+
+// Server serves the dashboard. It is a metrics.Sink: the records written to it are pushed to the pages
+type Server struct {
+	mux     *http.ServeMux
+	actions chan Action
+
+	mu      sync.Mutex
+	config  json.RawMessage
+	records []metrics.Record
+	samples []Sample
+	clients map[chan []byte]struct{}
+	closed  bool
+}
+
+// New returns a Server showing config, the JSON encoded configuration of the training
+func New(config []byte) *Server {
+	s := &Server{
+		mux:     http.NewServeMux(),
+		actions: make(chan Action, 1),
+		config:  config,
+		clients: make(map[chan []byte]struct{}),
+	}
+	s.mux.HandleFunc("/", s.serveIndex)
+	s.mux.HandleFunc("/state", s.serveState)
+	s.mux.HandleFunc("/events", s.serveEvents)
+	s.mux.HandleFunc("/actions/", s.serveAction)
+	return s
+}
+
+// ServeHTTP serves the page, its state and its events
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Actions returns the actions asked by the pages. An action is dropped while the previous one is pending
+func (s *Server) Actions() <-chan Action {
+	return s.actions
+}
+
+// Write records r and pushes it to the pages
+func (s *Server) Write(r metrics.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, r)
+	if len(s.records) > maxRecords {
+		s.records = append(s.records[:0], s.records[len(s.records)-maxRecords:]...)
+	}
+	return s.broadcast("record", r)
+}
+
+// AddSample keeps sample and pushes it to the pages
+func (s *Server) AddSample(sample Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples = append(s.samples, sample)
+	if len(s.samples) > maxSamples {
+		s.samples = append(s.samples[:0], s.samples[len(s.samples)-maxSamples:]...)
+	}
+	return s.broadcast("sample", sample)
+}
+
+// Notify shows a message on the pages, such as the outcome of an action
+func (s *Server) Notify(message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.broadcast("message", message)
+}
+
+// Close ends the event streams of the pages
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for c := range s.clients {
+		close(c)
+		delete(s.clients, c)
+	}
+	return nil
+}
+
+// broadcast sends an event to every page, s.mu must be held
+func (s *Server) broadcast(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	event := []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", name, data))
+	for c := range s.clients {
+		select {
+		case c <- event:
+		default:
+			// the page is too slow, it gets the next events
+		}
+	}
+	return nil
+}
+
+func (s *Server) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+// serveState returns the configuration, the records and the samples so far
+func (s *Server) serveState(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	state := struct {
+		Config  json.RawMessage  `json:"config"`
+		Records []metrics.Record `json:"records"`
+		Samples []Sample         `json:"samples"`
+	}{s.config, s.records, s.samples}
+	data, err := json.Marshal(state)
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// serveEvents streams the records, the samples and the messages as server-sent events
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	c := make(chan []byte, clientBuffer)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		http.Error(w, "the training is over", http.StatusGone)
+		return
+	}
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if _, ok := s.clients[c]; ok {
+			delete(s.clients, c)
+		}
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case event, ok := <-c:
+			if !ok {
+				return
+			}
+			if _, err := w.Write(event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// serveAction queues the action named by the path, /actions/checkpoint or /actions/sample
+func (s *Server) serveAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "an action must be posted", http.StatusMethodNotAllowed)
+		return
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "an action must be posted by the dashboard", http.StatusForbidden)
+		return
+	}
+	var action Action
+	switch r.URL.Path[len("/actions/"):] {
+	case CheckpointAction.String():
+		action = CheckpointAction
+	case SampleAction.String():
+		action = SampleAction
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	select {
+	case s.actions <- action:
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "an action is already pending", http.StatusServiceUnavailable)
+	}
+}
+
+// sameOrigin tells if r may ask for an action. The actions are not authenticated, so a page of another
+// site must not post them, either through the browser of the user, which then sends the Origin of that
+// page, or by resolving its own name to the address of the dashboard, which is then the Host
+func sameOrigin(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	if host != "localhost" && net.ParseIP(strings.Trim(host, "[]")) == nil {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// ListenAddr returns addr on 127.0.0.1 if it names no host, such as :8080: the dashboard is only
+// reachable from other hosts if its address says so
+func ListenAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != "" {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// URL returns the address of the page served on addr, as returned by ListenAddr
+func URL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr + "/"
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/"
+}
@@ -0,0 +1,185 @@
+package dashboard
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fahri-r/iteung-go/metrics"
+)
+
+func TestState(t *testing.T) {
+	s := New([]byte(`{"model":{"hidden_size":4}}`))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	if err := s.Write(metrics.Record{Step: 1, Loss: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddSample(Sample{Step: 1, Prompt: "a", Text: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("bad page: %v %v", res.Status, res.Header.Get("Content-Type"))
+	}
+
+	res, err = http.Get(ts.URL + "/state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var state struct {
+		Config  map[string]interface{}
+		Records []metrics.Record
+		Samples []Sample
+	}
+	if err := json.NewDecoder(res.Body).Decode(&state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Config["model"] == nil || len(state.Records) != 1 || state.Records[0].Loss != 2 || len(state.Samples) != 1 {
+		t.Fatalf("bad state %+v", state)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	s := New(nil)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	res, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("bad content type %v", res.Header.Get("Content-Type"))
+	}
+	// the page is registered once the headers are sent
+	if err := s.Write(metrics.Record{Step: 7}); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(res.Body)
+	line, err := r.ReadString('\n')
+	if err != nil || line != "event: record\n" {
+		t.Fatalf("expected a record event, got %q (%v)", line, err)
+	}
+	if line, err = r.ReadString('\n'); err != nil || !strings.Contains(line, `"step":7`) {
+		t.Fatalf("expected the record, got %q (%v)", line, err)
+	}
+
+	// closing the server ends the stream
+	s.Close()
+	done := make(chan struct{})
+	go func() {
+		for {
+			if _, err := r.ReadString('\n'); err != nil {
+				close(done)
+				return
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream should end once the server is closed")
+	}
+}
+
+func TestActions(t *testing.T) {
+	s := New(nil)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	post := func(path string) int {
+		res, err := http.Post(ts.URL+path, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if code := post("/actions/sample"); code != http.StatusAccepted {
+		t.Fatalf("expected the action to be accepted, got %v", code)
+	}
+	if code := post("/actions/checkpoint"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected the action to be refused while another one is pending, got %v", code)
+	}
+	if action := <-s.Actions(); action != SampleAction {
+		t.Fatalf("expected %v, got %v", SampleAction, action)
+	}
+	if code := post("/actions/checkpoint"); code != http.StatusAccepted {
+		t.Fatalf("expected the action to be accepted, got %v", code)
+	}
+	if action := <-s.Actions(); action != CheckpointAction {
+		t.Fatalf("expected %v, got %v", CheckpointAction, action)
+	}
+	if code := post("/actions/unknown"); code != http.StatusNotFound {
+		t.Fatalf("expected an unknown action to be rejected, got %v", code)
+	}
+}
+
+func TestActionOrigin(t *testing.T) {
+	s := New(nil)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	post := func(host, origin string) int {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/actions/sample", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if host != "" {
+			req.Host = host
+		}
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if code := post("", "http://evil.example"); code != http.StatusForbidden {
+		t.Fatalf("expected an action posted by another site to be refused, got %v", code)
+	}
+	if code := post("evil.example:8080", ""); code != http.StatusForbidden {
+		t.Fatalf("expected an action posted to another host name to be refused, got %v", code)
+	}
+	if code := post("localhost:8080", "http://localhost:8080"); code != http.StatusAccepted {
+		t.Fatalf("expected an action posted by the dashboard to be accepted, got %v", code)
+	}
+	if action := <-s.Actions(); action != SampleAction {
+		t.Fatalf("expected %v, got %v", SampleAction, action)
+	}
+	if code := post("", ts.URL); code != http.StatusAccepted {
+		t.Fatalf("expected an action posted by the dashboard to be accepted, got %v", code)
+	}
+}
+
+func TestAddress(t *testing.T) {
+	for _, tc := range []struct {
+		addr, listen, url string
+	}{
+		{":8080", "127.0.0.1:8080", "http://127.0.0.1:8080/"},
+		{"localhost:8080", "localhost:8080", "http://localhost:8080/"},
+		{"0.0.0.0:8080", "0.0.0.0:8080", "http://127.0.0.1:8080/"},
+		{"[::]:8080", "[::]:8080", "http://127.0.0.1:8080/"},
+		{"[::1]:8080", "[::1]:8080", "http://[::1]:8080/"},
+	} {
+		listen := ListenAddr(tc.addr)
+		if listen != tc.listen {
+			t.Fatalf("%v: expected to listen on %v, got %v", tc.addr, tc.listen, listen)
+		}
+		if url := URL(listen); url != tc.url {
+			t.Fatalf("%v: expected the URL %v, got %v", tc.addr, tc.url, url)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package gorgonia
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+	"gorgonia.org/tensor"
+)
+
+// GradStats holds the L2 norms of the gradients of a step, before they are clipped
+type GradStats struct {
+	// Norms holds the norm of the gradient of every parameter, keyed by the name of the parameter,
+	// or by its position if the parameters of the model do not all have a name of their own
+	Norms map[string]float64
+	// GlobalNorm is the norm of all the gradients together
+	GlobalNorm float64
+	// Clipped is true if the gradients have been rescaled
+	Clipped bool
+}
+
+// GradStatsReporter is anything that reports the gradients of its last step
+type GradStatsReporter interface {
+	GradStats() GradStats
+}
+
+// GlobalNormClipper is a Solver that rescales the gradients of all the parameters together before stepping the solver it wraps,
+// so their global L2 norm is at most maxNorm. Unlike WithClip, the direction of the gradient is kept.
+// Paper: https://arxiv.org/abs/1211.5063
+type GlobalNormClipper struct {
+	solver  Solver
+	maxNorm float64
+	names   []string
+	stats   GradStats
+}
+
+// NewGlobalNormClipper wraps solver. A maxNorm of zero never clips but still computes the GradStats
+func NewGlobalNormClipper(solver Solver, maxNorm float64) *GlobalNormClipper {
+	return &GlobalNormClipper{
+		solver:  solver,
+		maxNorm: maxNorm,
+	}
+}
+
+// Step computes the norms of the gradients, rescales them if needed and steps the wrapped solver
+func (c *GlobalNormClipper) Step(model []ValueGrad) error {
+	c.names = paramKeys(model)
+	stats := GradStats{Norms: make(map[string]float64, len(model))}
+	grads := make([]Value, len(model))
+	var sum float64
+	for i, n := range model {
+		_, grad, err := extractWeightGrad(n)
+		if err != nil {
+			return err
+		}
+		norm2, err := squaredNorm(grad)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to compute the gradient norm of %v", c.names[i])
+		}
+		grads[i] = grad
+		stats.Norms[c.names[i]] = math.Sqrt(norm2)
+		sum += norm2
+	}
+	stats.GlobalNorm = math.Sqrt(sum)
+	if c.maxNorm > 0 && stats.GlobalNorm > c.maxNorm {
+		stats.Clipped = true
+		scale := c.maxNorm / stats.GlobalNorm
+		for i, grad := range grads {
+			if err := scaleGrad(grad, scale); err != nil {
+				return errors.Wrapf(err, "Failed to clip the gradient of %v", c.names[i])
+			}
+		}
+	}
+	c.stats = stats
+	return c.solver.Step(model)
+}
+
+// GradStats returns the norms of the gradients of the last step
+func (c *GlobalNormClipper) GradStats() GradStats {
+	return c.stats
+}
+
+// Observe passes the loss to the wrapped solver if it adapts to it
+func (c *GlobalNormClipper) Observe(loss float64) {
+	if o, ok := c.solver.(Observer); ok {
+		o.Observe(loss)
+	}
+}
+
+// State returns the state of the wrapped solver
+func (c *GlobalNormClipper) State() (SolverState, error) {
+	ss, ok := c.solver.(StatefulSolver)
+	if !ok {
+		return SolverState{}, nil
+	}
+	return ss.State()
+}
+
+// SetState restores the state of the wrapped solver
+func (c *GlobalNormClipper) SetState(state SolverState) error {
+	ss, ok := c.solver.(StatefulSolver)
+	if !ok {
+		return errors.Errorf("Cannot restore the state of %T", c.solver)
+	}
+	return ss.SetState(state)
+}
+
+// squaredNorm returns the sum of the squares of the elements of v
+func squaredNorm(v Value) (float64, error) {
+	var sum float64
+	switch vt := v.(type) {
+	case *tensor.Dense:
+		switch data := vt.Data().(type) {
+		case []float64:
+			for _, d := range data {
+				sum += d * d
+			}
+			return sum, nil
+		case []float32:
+			for _, d := range data {
+				sum += float64(d) * float64(d)
+			}
+			return sum, nil
+		}
+	case *F64:
+		return float64(*vt) * float64(*vt), nil
+	case *F32:
+		return float64(*vt) * float64(*vt), nil
+	}
+	return 0, errors.Errorf(nyiTypeFail, "squaredNorm", v)
+}
+
+// scaleGrad multiplies the gradient in place
+func scaleGrad(grad Value, scale float64) error {
+	switch g := grad.(type) {
+	case *tensor.Dense:
+		var s interface{} = scale
+		if g.Dtype() == tensor.Float32 {
+			s = float32(scale)
+		}
+		if _, err := tensor.Mul(g, s, tensor.UseUnsafe()); err != nil {
+			return errors.Wrap(err, pointWiseMulFail)
+		}
+		return nil
+	case *F64:
+		*g = F64(float64(*g) * scale)
+		return nil
+	case *F32:
+		*g = F32(float32(float64(*g) * scale))
+		return nil
+	}
+	return errors.Errorf(nyiTypeFail, "scaleGrad", grad)
+}
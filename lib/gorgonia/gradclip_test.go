@@ -0,0 +1,99 @@
+package gorgonia
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGlobalNormClipper(t *testing.T) {
+	for _, maxNorm := range []float64{0, 1, 1e3} {
+		m := newStateModel(t, []float64{0.5, -0.5, 1, 2}, []float64{0.1, -0.1})
+		m.machine.Reset()
+		if err := m.machine.RunAll(); err != nil {
+			t.Fatal(err)
+		}
+		grads := make(map[string][]float64)
+		var sum float64
+		for _, n := range m.params {
+			g, err := n.Grad()
+			if err != nil {
+				t.Fatal(err)
+			}
+			grads[n.Name()] = append([]float64(nil), g.Data().([]float64)...)
+			for _, v := range grads[n.Name()] {
+				sum += v * v
+			}
+		}
+		globalNorm := math.Sqrt(sum)
+		w, b := m.values()
+		before := map[string][]float64{"w": w, "b": b}
+
+		// with a learn rate of 1, the VanillaSolver subtracts the clipped gradients from the weights
+		clipper := NewGlobalNormClipper(NewVanillaSolver(WithLearnRate(1)), maxNorm)
+		if err := clipper.Step(NodesToValueGrads(m.params)); err != nil {
+			t.Fatal(err)
+		}
+		stats := clipper.GradStats()
+		if math.Abs(stats.GlobalNorm-globalNorm) > 1e-12 {
+			t.Fatalf("expected the global norm %v, got %v", globalNorm, stats.GlobalNorm)
+		}
+		clipped := maxNorm > 0 && globalNorm > maxNorm
+		if stats.Clipped != clipped {
+			t.Fatalf("max norm %v: clipped should be %v", maxNorm, clipped)
+		}
+		scale := 1.0
+		if clipped {
+			scale = maxNorm / globalNorm
+		}
+		w, b = m.values()
+		after := map[string][]float64{"w": w, "b": b}
+		for name, g := range grads {
+			var norm2 float64
+			for i, v := range g {
+				norm2 += v * v
+				if delta := before[name][i] - after[name][i]; math.Abs(delta-v*scale) > 1e-12 {
+					t.Fatalf("max norm %v: %v[%v] moved by %v, expected %v", maxNorm, name, i, delta, v*scale)
+				}
+			}
+			if math.Abs(stats.Norms[name]-math.Sqrt(norm2)) > 1e-12 {
+				t.Fatalf("expected the norm %v for %v, got %v", math.Sqrt(norm2), name, stats.Norms[name])
+			}
+		}
+	}
+}
+
+func TestGlobalNormClipperSameNames(t *testing.T) {
+	m := newTwinModel(t)
+	m.wrap = func(n *Node) ValueGrad { return renamed{n, "p"} }
+	clipper := NewGlobalNormClipper(NewVanillaSolver(), 0)
+	m.step(t, clipper, 0, 1)
+	if norms := clipper.GradStats().Norms; len(norms) != 2 || norms["0"] == norms["1"] {
+		t.Fatalf("expected a norm of each parameter, got %v", norms)
+	}
+}
+
+func TestGlobalNormClipperForwards(t *testing.T) {
+	scheduler, err := NewScheduler(NewRMSPropSolver(WithLearnRate(0.1)), NewReduceOnPlateau(0.5, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clipper := NewGlobalNormClipper(scheduler, 1)
+	m := newStateModel(t, []float64{0.5, -0.5, 1, 2}, []float64{0.1, -0.1})
+	m.step(t, clipper, 0, 1)
+	clipper.Observe(1)
+	clipper.Observe(2)
+	m.step(t, clipper, 0, 1)
+	if rate, ok := LearnRateOf(clipper); !ok || rate != 0.05 {
+		t.Fatalf("expected the learn rate of the scheduler, got %v", rate)
+	}
+	state, err := clipper.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Params) != 2 || state.Schedule == nil || state.Schedule.Step != 2 {
+		t.Fatalf("expected the state of the scheduler, got %+v", state)
+	}
+	if err := clipper.SetState(state); err != nil {
+		t.Fatal(err)
+	}
+}
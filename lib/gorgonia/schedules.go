@@ -0,0 +1,295 @@
+package gorgonia
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule computes the learn rate of a step from the learn rate the solver has been created with
+type Schedule interface {
+	// LearnRate returns the learn rate of the step, counted from 0
+	LearnRate(step int, base float64) float64
+}
+
+// Observer is anything that adapts to the loss of the model, such as the ReduceOnPlateau schedule
+type Observer interface {
+	Observe(loss float64)
+}
+
+// ScheduleState is the position of a Scheduler in its schedule
+type ScheduleState struct {
+	Step int
+	// Observed, Best, Stale and Scale are the state of a ReduceOnPlateau schedule
+	Observed bool
+	Best     float64
+	Stale    int
+	Scale    float64
+}
+
+// statefulSchedule is a schedule whose learn rate does not only depend on the step
+type statefulSchedule interface {
+	state(s *ScheduleState)
+	setState(s ScheduleState)
+}
+
+// LearnRateOf returns the learn rate of the solver, and false if the solver has no learn rate
+func LearnRateOf(s Solver) (float64, bool) {
+	switch st := s.(type) {
+	case *RMSPropSolver:
+		return st.eta, true
+	case *AdamSolver:
+		return st.eta, true
+	case *VanillaSolver:
+		return st.eta, true
+	case *BarzilaiBorweinSolver:
+		return st.eta, true
+	case *Momentum:
+		return st.eta, true
+	case *AdaGradSolver:
+		return st.eta, true
+	case *AdamW:
+		return st.η, true
+	case *Scheduler:
+		return st.rate, true
+	case *GlobalNormClipper:
+		return LearnRateOf(st.solver)
+	}
+	return 0, false
+}
+
+// Scheduler is a Solver that sets the learn rate of the solver it wraps before every step
+type Scheduler struct {
+	solver   Solver
+	schedule Schedule
+	base     float64 // learn rate of the wrapped solver
+	rate     float64 // learn rate of the last step
+	step     int
+}
+
+// NewScheduler wraps solver, whose learn rate is changed at every step as told by schedule
+func NewScheduler(solver Solver, schedule Schedule) (*Scheduler, error) {
+	base, ok := LearnRateOf(solver)
+	if !ok {
+		return nil, errors.Errorf("Cannot schedule the learn rate of %T", solver)
+	}
+	return &Scheduler{
+		solver:   solver,
+		schedule: schedule,
+		base:     base,
+		rate:     base,
+	}, nil
+}
+
+// Step sets the learn rate of the step and steps the wrapped solver
+func (s *Scheduler) Step(model []ValueGrad) error {
+	s.rate = s.schedule.LearnRate(s.step, s.base)
+	WithLearnRate(s.rate)(s.solver)
+	s.step++
+	return s.solver.Step(model)
+}
+
+// Observe passes the loss to the schedule if it adapts to it
+func (s *Scheduler) Observe(loss float64) {
+	if o, ok := s.schedule.(Observer); ok {
+		o.Observe(loss)
+	}
+}
+
+// State returns the state of the wrapped solver along with the position in the schedule
+func (s *Scheduler) State() (SolverState, error) {
+	var state SolverState
+	if ss, ok := s.solver.(StatefulSolver); ok {
+		var err error
+		if state, err = ss.State(); err != nil {
+			return SolverState{}, err
+		}
+	}
+	state.Schedule = &ScheduleState{Step: s.step}
+	if st, ok := s.schedule.(statefulSchedule); ok {
+		st.state(state.Schedule)
+	}
+	return state, nil
+}
+
+// SetState restores the state of the wrapped solver and the position in the schedule
+func (s *Scheduler) SetState(state SolverState) error {
+	ss, ok := s.solver.(StatefulSolver)
+	if !ok {
+		return errors.Errorf("Cannot restore the state of %T", s.solver)
+	}
+	if err := ss.SetState(state); err != nil {
+		return err
+	}
+	if state.Schedule == nil {
+		return nil
+	}
+	s.step = state.Schedule.Step
+	if st, ok := s.schedule.(statefulSchedule); ok {
+		st.setState(*state.Schedule)
+	}
+	return nil
+}
+
+// StepDecay multiplies the learn rate by gamma every n steps
+type StepDecay struct {
+	every int
+	gamma float64
+}
+
+// NewStepDecay creates a StepDecay schedule
+func NewStepDecay(every int, gamma float64) *StepDecay {
+	return &StepDecay{every: every, gamma: gamma}
+}
+
+// LearnRate returns base × gamma^⌊step/every⌋
+func (s *StepDecay) LearnRate(step int, base float64) float64 {
+	if s.every <= 0 {
+		return base
+	}
+	return base * math.Pow(s.gamma, float64(step/s.every))
+}
+
+// ExponentialDecay multiplies the learn rate by gamma at every step
+type ExponentialDecay struct {
+	gamma float64
+}
+
+// NewExponentialDecay creates an ExponentialDecay schedule
+func NewExponentialDecay(gamma float64) *ExponentialDecay {
+	return &ExponentialDecay{gamma: gamma}
+}
+
+// LearnRate returns base × gamma^step
+func (s *ExponentialDecay) LearnRate(step int, base float64) float64 {
+	return base * math.Pow(s.gamma, float64(step))
+}
+
+// CosineAnnealing decreases the learn rate from its base value to min along a half cosine, and restarts
+// from the base value at the end of every period (SGDR). The period is multiplied by mult after every restart.
+// Paper: https://arxiv.org/abs/1608.03983
+type CosineAnnealing struct {
+	period int
+	mult   int
+	min    float64
+}
+
+// NewCosineAnnealing creates a CosineAnnealing schedule. A mult lower than 1 keeps the period constant
+func NewCosineAnnealing(period, mult int, min float64) *CosineAnnealing {
+	if mult < 1 {
+		mult = 1
+	}
+	return &CosineAnnealing{period: period, mult: mult, min: min}
+}
+
+// LearnRate returns min + (base - min) × (1 + cos(π × t / T)) / 2 where t is the step in the current period of T steps
+func (s *CosineAnnealing) LearnRate(step int, base float64) float64 {
+	if s.period <= 0 {
+		return base
+	}
+	t, period := step, s.period
+	for t >= period {
+		t -= period
+		period *= s.mult
+	}
+	return s.min + (base-s.min)*(1+math.Cos(math.Pi*float64(t)/float64(period)))/2
+}
+
+// LinearWarmup increases the learn rate linearly up to its base value during the first steps, then follows another schedule
+type LinearWarmup struct {
+	steps int
+	then  Schedule
+}
+
+// NewLinearWarmup creates a LinearWarmup schedule. The steps following the warmup are counted from 0 by then;
+// a nil then keeps the base learn rate
+func NewLinearWarmup(steps int, then Schedule) *LinearWarmup {
+	return &LinearWarmup{steps: steps, then: then}
+}
+
+// LearnRate returns base × (step+1) / steps during the warmup
+func (s *LinearWarmup) LearnRate(step int, base float64) float64 {
+	if step < s.steps {
+		return base * float64(step+1) / float64(s.steps)
+	}
+	if s.then == nil {
+		return base
+	}
+	return s.then.LearnRate(step-s.steps, base)
+}
+
+// Observe passes the loss to the schedule following the warmup
+func (s *LinearWarmup) Observe(loss float64) {
+	if o, ok := s.then.(Observer); ok {
+		o.Observe(loss)
+	}
+}
+
+func (s *LinearWarmup) state(st *ScheduleState) {
+	if then, ok := s.then.(statefulSchedule); ok {
+		then.state(st)
+	}
+}
+
+func (s *LinearWarmup) setState(st ScheduleState) {
+	if then, ok := s.then.(statefulSchedule); ok {
+		then.setState(st)
+	}
+}
+
+// ReduceOnPlateau multiplies the learn rate by factor once the observed loss has not decreased for more than patience observations.
+// The learn rate is never lower than min
+type ReduceOnPlateau struct {
+	factor   float64
+	patience int
+	min      float64
+
+	observed bool
+	best     float64
+	stale    int
+	scale    float64
+}
+
+// NewReduceOnPlateau creates a ReduceOnPlateau schedule
+func NewReduceOnPlateau(factor float64, patience int, min float64) *ReduceOnPlateau {
+	return &ReduceOnPlateau{
+		factor:   factor,
+		patience: patience,
+		min:      min,
+		scale:    1,
+	}
+}
+
+// LearnRate returns the base learn rate multiplied by factor for every plateau observed so far
+func (s *ReduceOnPlateau) LearnRate(step int, base float64) float64 {
+	return math.Max(base*s.scale, s.min)
+}
+
+// Observe records the loss of the model
+func (s *ReduceOnPlateau) Observe(loss float64) {
+	if !s.observed || loss < s.best {
+		s.observed = true
+		s.best = loss
+		s.stale = 0
+		return
+	}
+	s.stale++
+	if s.stale > s.patience {
+		s.scale *= s.factor
+		s.stale = 0
+	}
+}
+
+func (s *ReduceOnPlateau) state(st *ScheduleState) {
+	st.Observed = s.observed
+	st.Best = s.best
+	st.Stale = s.stale
+	st.Scale = s.scale
+}
+
+func (s *ReduceOnPlateau) setState(st ScheduleState) {
+	s.observed = st.Observed
+	s.best = st.Best
+	s.stale = st.Stale
+	s.scale = st.Scale
+}
@@ -0,0 +1,113 @@
+package gorgonia
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestSchedules(t *testing.T) {
+	testCases := []struct {
+		name     string
+		schedule Schedule
+		// the expected learn rates of the first steps for a base learn rate of 1
+		expected []float64
+	}{
+		{"step decay", NewStepDecay(2, 0.5), []float64{1, 1, 0.5, 0.5, 0.25}},
+		{"exponential decay", NewExponentialDecay(0.5), []float64{1, 0.5, 0.25, 0.125}},
+		{"cosine annealing", NewCosineAnnealing(2, 1, 0), []float64{1, 0.5, 1, 0.5, 1}},
+		{"cosine annealing with longer periods", NewCosineAnnealing(2, 2, 0.2), []float64{1, 0.6, 1, 1 - 0.8*(1-math.Sqrt2/2)/2, 0.6, 1 - 0.8*(1+math.Sqrt2/2)/2, 1}},
+		{"linear warmup", NewLinearWarmup(4, nil), []float64{0.25, 0.5, 0.75, 1, 1}},
+		{"linear warmup then decay", NewLinearWarmup(2, NewExponentialDecay(0.5)), []float64{0.5, 1, 1, 0.5}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for step, expected := range tc.expected {
+				if rate := tc.schedule.LearnRate(step, 1); math.Abs(rate-expected) > 1e-12 {
+					t.Fatalf("step %v: expected %v, got %v", step, expected, rate)
+				}
+			}
+		})
+	}
+}
+
+func TestReduceOnPlateau(t *testing.T) {
+	s := NewReduceOnPlateau(0.5, 1, 0.3)
+	for i, tc := range []struct {
+		loss     float64
+		expected float64
+	}{
+		{2, 1},
+		{1, 1},
+		{1.5, 1},   // first stale observation
+		{1.2, 0.5}, // second one, the patience is exceeded
+		{1.1, 0.5},
+		{1.1, 0.3}, // never lower than min
+		{0.5, 0.3},
+	} {
+		s.Observe(tc.loss)
+		if rate := s.LearnRate(i, 1); rate != tc.expected {
+			t.Fatalf("observation %v: expected %v, got %v", i, tc.expected, rate)
+		}
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	if _, err := NewScheduler(&Scheduler{}, NewExponentialDecay(0.5)); err != nil {
+		t.Fatal("a Scheduler has a learn rate and can be scheduled")
+	}
+
+	newScheduler := func() *Scheduler {
+		s, err := NewScheduler(NewRMSPropSolver(WithLearnRate(0.1)), NewLinearWarmup(1, NewReduceOnPlateau(0.5, 0, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	m := newStateModel(t, []float64{0.5, -0.5, 1, 2}, []float64{0.1, -0.1})
+	s := newScheduler()
+	m.step(t, s, 0, 1)
+	s.Observe(2)
+	m.step(t, s, 0, 1)
+	s.Observe(3)
+	m.step(t, s, 0, 1)
+	if rate, _ := LearnRateOf(s); rate != 0.05 {
+		t.Fatalf("expected the learn rate 0.05, got %v", rate)
+	}
+	if rate, _ := LearnRateOf(s.solver); rate != 0.05 {
+		t.Fatalf("the learn rate of the wrapped solver should be 0.05, got %v", rate)
+	}
+
+	state, err := s.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restoredState SolverState
+	if err := json.Unmarshal(data, &restoredState); err != nil {
+		t.Fatal(err)
+	}
+	w, b := m.values()
+	restored := newStateModel(t, w, b)
+	resumed := newScheduler()
+	if err := resumed.SetState(restoredState); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		m.step(t, s, 0, 1)
+		restored.step(t, resumed, 0, 1)
+	}
+	rw, _ := restored.values()
+	w, _ = m.values()
+	for i := range w {
+		if w[i] != rw[i] {
+			t.Fatalf("expected %v, got %v", w, rw)
+		}
+	}
+	if rate, _ := LearnRateOf(resumed); rate != 0.05 {
+		t.Fatalf("the resumed learn rate should be 0.05, got %v", rate)
+	}
+}
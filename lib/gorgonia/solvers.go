@@ -178,8 +178,12 @@ func WithLearnRate(eta float64) SolverOpt {
 			st.eta = eta
 		case *Momentum:
 			st.eta = eta
+		case *AdaGradSolver:
+			st.eta = eta
 		case *AdamW:
 			st.η = eta
+		case *GlobalNormClipper:
+			WithLearnRate(eta)(st.solver)
 		}
 	}
 	return f
@@ -247,7 +251,7 @@ type RMSPropSolver struct {
 	useClip, useL2Reg bool
 
 	// unsettable
-	cache []*dualValue
+	params solverParams
 }
 
 // NewRMSPropSolver creates an RMSProp solver with these default values:
@@ -271,10 +275,7 @@ func NewRMSPropSolver(opts ...SolverOpt) *RMSPropSolver {
 //
 // This function will error out if the nodes do not have an associated Grad value.
 func (s *RMSPropSolver) Step(model []ValueGrad) (err error) {
-	if s.cache == nil {
-		s.cache = make([]*dualValue, len(model))
-	}
-
+	keys := paramKeys(model)
 	for i, n := range model {
 		var weights, grad Value
 		if weights, grad, err = extractWeightGrad(n); err != nil {
@@ -282,11 +283,8 @@ func (s *RMSPropSolver) Step(model []ValueGrad) (err error) {
 		}
 
 		var cached *dualValue
-		if cached = s.cache[i]; cached == nil {
-			if cached, err = newCachedDV(n, weights, grad, true); err != nil {
-				return err
-			}
-			s.cache[i] = cached
+		if cached, err = s.params.cached(keys[i], n, weights, grad); err != nil {
+			return err
 		}
 
 		cv := cached.Value
@@ -412,6 +410,17 @@ func (s *RMSPropSolver) Step(model []ValueGrad) (err error) {
 	return nil
 }
 
+// State returns the mean of the squared gradients of every parameter
+func (s *RMSPropSolver) State() (SolverState, error) {
+	return s.params.state(0)
+}
+
+// SetState restores the mean of the squared gradients of the parameters
+func (s *RMSPropSolver) SetState(state SolverState) error {
+	s.params.setState(state)
+	return nil
+}
+
 // AdamSolver is the Adaptive Moment Estimation solver (basically RMSProp on steroids).
 // Paper: http://arxiv.org/abs/1412.6980
 //
@@ -430,8 +439,8 @@ type AdamSolver struct {
 	useClip, useL1Reg, useL2Reg bool
 
 	// unsettable
-	iter  int
-	cache []*dualValue
+	iter   int
+	params solverParams
 }
 
 // NewAdamSolver creates an Adam solver with these default values:
@@ -459,10 +468,7 @@ func NewAdamSolver(opts ...SolverOpt) *AdamSolver {
 //
 // This function will error out if the nodes do not have an associated Grad value.
 func (s *AdamSolver) Step(model []ValueGrad) (err error) {
-	if s.cache == nil {
-		s.cache = make([]*dualValue, len(model))
-	}
-
+	keys := paramKeys(model)
 	s.iter++
 	correction1 := (1 - math.Pow(s.beta1, float64(s.iter)))
 	correction2 := (1 - math.Pow(s.beta2, float64(s.iter)))
@@ -474,11 +480,8 @@ func (s *AdamSolver) Step(model []ValueGrad) (err error) {
 		}
 
 		var cached *dualValue
-		if cached = s.cache[i]; cached == nil {
-			if cached, err = newCachedDV(n, weights, grad, true); err != nil {
-				return err
-			}
-			s.cache[i] = cached
+		if cached, err = s.params.cached(keys[i], n, weights, grad); err != nil {
+			return err
 		}
 
 		cvm := cached.Value // means of gradients
@@ -751,6 +754,18 @@ func (s *AdamSolver) Step(model []ValueGrad) (err error) {
 	return
 }
 
+// State returns the number of steps and the means and variances of the gradients of every parameter
+func (s *AdamSolver) State() (SolverState, error) {
+	return s.params.state(s.iter)
+}
+
+// SetState restores the number of steps and the means and variances of the gradients of the parameters
+func (s *AdamSolver) SetState(state SolverState) error {
+	s.iter = state.Iter
+	s.params.setState(state)
+	return nil
+}
+
 // VanillaSolver is your bog standard stochastic gradient descent optimizer. There are no fancy features to this
 type VanillaSolver struct {
 	eta   float64 // learn rate
@@ -942,6 +957,19 @@ func (s *VanillaSolver) Step(model []ValueGrad) (err error) {
 	return
 }
 
+// State returns an empty state: the VanillaSolver keeps nothing between two steps
+func (s *VanillaSolver) State() (SolverState, error) {
+	return SolverState{}, nil
+}
+
+// SetState fails if state holds accumulators, as the VanillaSolver has none
+func (s *VanillaSolver) SetState(state SolverState) error {
+	if len(state.Params) > 0 {
+		return errors.New("The VanillaSolver does not keep any accumulator")
+	}
+	return nil
+}
+
 // Momentum is the stochastic gradient descent optimizer with momentum item.
 type Momentum struct {
 	eta      float64 // learn rate
@@ -953,7 +981,7 @@ type Momentum struct {
 
 	useClip, useL1Reg, useL2Reg bool
 
-	cache []*dualValue
+	params solverParams
 }
 
 // NewMomentum creates a new Momentum with sane-ish default values
@@ -973,10 +1001,7 @@ func NewMomentum(opts ...SolverOpt) *Momentum {
 //
 // This function will error out if the nodes do not have an associated Grad value.
 func (s *Momentum) Step(model []ValueGrad) (err error) {
-	if s.cache == nil {
-		s.cache = make([]*dualValue, len(model))
-	}
-
+	keys := paramKeys(model)
 	for i, n := range model {
 		var weights, grad Value
 		if weights, grad, err = extractWeightGrad(n); err != nil {
@@ -984,11 +1009,8 @@ func (s *Momentum) Step(model []ValueGrad) (err error) {
 		}
 
 		var cached *dualValue
-		if cached = s.cache[i]; cached == nil {
-			if cached, err = newCachedDV(n, weights, grad, true); err != nil {
-				return err
-			}
-			s.cache[i] = cached
+		if cached, err = s.params.cached(keys[i], n, weights, grad); err != nil {
+			return err
 		}
 
 		cv := cached.Value
@@ -1171,6 +1193,17 @@ func (s *Momentum) Step(model []ValueGrad) (err error) {
 	return
 }
 
+// State returns the velocity of every parameter
+func (s *Momentum) State() (SolverState, error) {
+	return s.params.state(0)
+}
+
+// SetState restores the velocity of the parameters
+func (s *Momentum) SetState(state SolverState) error {
+	s.params.setState(state)
+	return nil
+}
+
 // AdaGradSolver is the solver that does adaptive gradient descent. Read the paper: http://jmlr.org/papers/v12/duchi11a.html
 type AdaGradSolver struct {
 	eta   float64 // learn rate
@@ -1181,7 +1214,7 @@ type AdaGradSolver struct {
 
 	useL2Reg, useClip bool
 
-	cache []*dualValue
+	params solverParams
 }
 
 // NewAdaGradSolver creates a new AdaGradSolver with sane-ish default values
@@ -1201,10 +1234,7 @@ func NewAdaGradSolver(opts ...SolverOpt) *AdaGradSolver {
 //
 // This function will error out if the nodes do not have an associated Grad value.
 func (s *AdaGradSolver) Step(model []ValueGrad) (err error) {
-	if s.cache == nil {
-		s.cache = make([]*dualValue, len(model))
-	}
-
+	keys := paramKeys(model)
 	for i, n := range model {
 		var weights, grad Value
 		if weights, grad, err = extractWeightGrad(n); err != nil {
@@ -1212,11 +1242,8 @@ func (s *AdaGradSolver) Step(model []ValueGrad) (err error) {
 		}
 
 		var cached *dualValue
-		if cached = s.cache[i]; cached == nil {
-			if cached, err = newCachedDV(n, weights, grad, true); err != nil {
-				return err
-			}
-			s.cache[i] = cached
+		if cached, err = s.params.cached(keys[i], n, weights, grad); err != nil {
+			return err
 		}
 
 		cv := cached.Value
@@ -1372,6 +1399,17 @@ func (s *AdaGradSolver) Step(model []ValueGrad) (err error) {
 	return
 }
 
+// State returns the sum of the squared gradients of every parameter
+func (s *AdaGradSolver) State() (SolverState, error) {
+	return s.params.state(0)
+}
+
+// SetState restores the sum of the squared gradients of the parameters
+func (s *AdaGradSolver) SetState(state SolverState) error {
+	s.params.setState(state)
+	return nil
+}
+
 // BarzilaiBorweinSolver / Barzilai-Borwein performs Gradient Descent in steepest descend direction
 // Solves 0 = F(x), by
 //  xᵢ₊₁ = xᵢ - eta * Grad(F)(xᵢ)
@@ -1385,7 +1423,7 @@ type BarzilaiBorweinSolver struct {
 	eta     float64 // initial learn rate
 	clip    float64 // clip value
 	useClip bool
-	prevDV  []*dualValue // dual value for xᵢ₋₁ step
+	params  solverParams // dual values for xᵢ₋₁ step
 }
 
 // NewBarzilaiBorweinSolver creates a new Barzilai-Borwein solver withs some default values:
@@ -1406,13 +1444,15 @@ func NewBarzilaiBorweinSolver(opts ...SolverOpt) *BarzilaiBorweinSolver {
 //
 // This function will error out if the nodes do not have an associated Grad value.
 func (s *BarzilaiBorweinSolver) Step(model []ValueGrad) (err error) {
-
-	firstRun := false
-	if s.prevDV == nil {
-		firstRun = true
-		s.prevDV = make([]*dualValue, len(model))
+	keys := paramKeys(model)
+	if len(s.params.cache) == 0 && len(s.params.pending) > 0 {
+		if err = s.params.restoreAll(model, keys); err != nil {
+			return err
+		}
 	}
 
+	firstRun := len(s.params.cache) == 0
+
 	// Update the learning rate
 	if false == firstRun {
 		nominator := float64(0.0)
@@ -1431,14 +1471,19 @@ func (s *BarzilaiBorweinSolver) Step(model []ValueGrad) (err error) {
 					return errors.Errorf("Expected a *tensor.Dense in %v. Got %T instead", node, grad)
 				}
 
-				wOld, ok := s.prevDV[nodeNr].Value.(*tensor.Dense)
+				prevDV, ok := s.params.cache[keys[nodeNr]]
+				if !ok {
+					return errors.Errorf("No previous step for %v", node)
+				}
+
+				wOld, ok := prevDV.Value.(*tensor.Dense)
 				if !ok {
-					return errors.Errorf("Expected a *tensor.Dense in %v. Got %T instead", node, s.prevDV[nodeNr].Value)
+					return errors.Errorf("Expected a *tensor.Dense in %v. Got %T instead", node, prevDV.Value)
 				}
 
-				gOld, ok := s.prevDV[nodeNr].d.(*tensor.Dense)
+				gOld, ok := prevDV.d.(*tensor.Dense)
 				if !ok {
-					return errors.Errorf("Expected a *tensor.Dense in %v. Got %T instead", node, s.prevDV[nodeNr].d)
+					return errors.Errorf("Expected a *tensor.Dense in %v. Got %T instead", node, prevDV.d)
 				}
 
 				valueDiff, err := tensor.Sub(w, wOld)
@@ -1496,21 +1541,25 @@ func (s *BarzilaiBorweinSolver) Step(model []ValueGrad) (err error) {
 	}
 
 	// Save this iteration's values for the next run
+	if firstRun {
+		s.params.cache = make(map[string]*dualValue, len(model))
+	}
 	for nodeNr, node := range model {
 		var weights, grad Value
 		if weights, grad, err = extractWeightGrad(node); err != nil {
 			return err
 		}
 
-		if false == firstRun {
+		name := keys[nodeNr]
+		if prevDV, ok := s.params.cache[name]; ok {
 			// return memory for the old dual value used in this iteration
-			returnDV(s.prevDV[nodeNr])
+			returnDV(prevDV)
 		}
 		var oldDV *dualValue
 		if oldDV, err = newCachedDV(node, weights, grad, false); err != nil {
 			return err
 		}
-		s.prevDV[nodeNr] = oldDV
+		s.params.cache[name] = oldDV
 	}
 
 	// Update the weights
@@ -1548,6 +1597,26 @@ func (s *BarzilaiBorweinSolver) Step(model []ValueGrad) (err error) {
 	return nil
 }
 
+// State returns the learn rate computed at the last step, and the weights and the gradients of the last step
+func (s *BarzilaiBorweinSolver) State() (SolverState, error) {
+	state, err := s.params.state(0)
+	state.LearnRate = s.eta
+	return state, err
+}
+
+// SetState restores the learn rate, and the weights and the gradients of the last step.
+// Every parameter must be restored, as the learn rate of the next step depends on all of them
+func (s *BarzilaiBorweinSolver) SetState(state SolverState) error {
+	if state.LearnRate != 0 {
+		s.eta = state.LearnRate
+	}
+	for _, dv := range s.params.cache {
+		returnDV(dv)
+	}
+	s.params.setState(state)
+	return nil
+}
+
 type adamwState struct {
 	expMA   tensor.Tensor // exponential moving average
 	expMASq tensor.Tensor
@@ -1572,7 +1641,8 @@ type AdamW struct {
 
 	// unsettable
 	iter   float64
-	states map[*Node]*adamwState
+	states map[string]*adamwState // keyed by the names of the parameters
+	params solverParams
 }
 
 func NewAdamW(opts ...SolverOpt) *AdamW {
@@ -1582,7 +1652,7 @@ func NewAdamW(opts ...SolverOpt) *AdamW {
 		λ:      0.01,
 		β1:     0.9,
 		β2:     0.999,
-		states: make(map[*Node]*adamwState),
+		states: make(map[string]*adamwState),
 	}
 	for _, opt := range opts {
 		opt(s)
@@ -1599,8 +1669,9 @@ func (a *AdamW) Step(model []ValueGrad) (err error) {
 	        v  - the second momennt (MA squared)
 	*/
 	a.iter++
-	for _, n := range model {
-		n := n.(*Node)
+	keys := paramKeys(model)
+	for i, n := range model {
+		name := keys[i]
 		var weights, grad Value
 		if weights, grad, err = extractWeightGrad(n); err != nil {
 			return err
@@ -1608,13 +1679,19 @@ func (a *AdamW) Step(model []ValueGrad) (err error) {
 		w := weights.(tensor.Tensor)
 		g := grad.(tensor.Tensor)
 
-		st, ok := a.states[n]
+		st, ok := a.states[name]
 		if !ok {
 			st = new(adamwState)
 			st.expMA = tensor.New(tensor.WithShape(grad.Shape().Clone()...), tensor.Of(grad.Dtype()))
 			st.expMASq = tensor.New(tensor.WithShape(grad.Shape().Clone()...), tensor.Of(grad.Dtype()))
 			st.denom = tensor.New(tensor.WithShape(grad.Shape().Clone()...), tensor.Of(grad.Dtype()))
-			a.states[n] = st
+			if ps, ok := a.params.pending[name]; ok {
+				delete(a.params.pending, name)
+				if err = ps.restoreTensors(st.expMA, st.expMASq); err != nil {
+					return errors.Wrapf(err, "Failed to restore the state of %v", name)
+				}
+			}
+			a.states[name] = st
 		}
 
 		var decay, a1, a2, b1, b2, b2sqrt, ss, eps interface{}
@@ -1736,3 +1813,34 @@ func (a *AdamW) Step(model []ValueGrad) (err error) {
 	}
 	return nil
 }
+
+// State returns the number of steps and the moving averages of the gradients and of the squared gradients of every parameter
+func (a *AdamW) State() (SolverState, error) {
+	state := SolverState{
+		Iter:   int(a.iter),
+		Params: make(map[string]ParamState, len(a.states)+len(a.params.pending)),
+	}
+	for name, ps := range a.params.pending {
+		state.Params[name] = ps
+	}
+	for name, st := range a.states {
+		ps := ParamState{Shape: st.expMA.Shape().Clone()}
+		for _, t := range []tensor.Tensor{st.expMA, st.expMASq} {
+			data, err := valueData(t)
+			if err != nil {
+				return SolverState{}, errors.Wrapf(err, "Failed to save the state of %v", name)
+			}
+			ps.Accumulators = append(ps.Accumulators, data)
+		}
+		state.Params[name] = ps
+	}
+	return state, nil
+}
+
+// SetState restores the number of steps and the moving averages of the parameters
+func (a *AdamW) SetState(state SolverState) error {
+	a.iter = float64(state.Iter)
+	a.states = make(map[string]*adamwState)
+	a.params.setState(state)
+	return nil
+}
@@ -92,7 +92,7 @@ func manualRMSProp64(t *testing.T, s *RMSPropSolver, model []ValueGrad) {
 			t.Error(err)
 		}
 
-		sCache := s.cache[0].Value.(tensor.Tensor)
+		sCache := s.params.cache[paramKeys(model)[0]].Value.(tensor.Tensor)
 		assert.Equal(correct, backingV, "Iteration: %d", i)
 		assert.Equal(cached, sCache.Data(), "Iteration: %d", i)
 
@@ -137,7 +137,7 @@ func manualRMSProp32(t *testing.T, s *RMSPropSolver, model []ValueGrad) {
 			t.Error(err)
 		}
 
-		sCache := s.cache[0].Value.(tensor.Tensor)
+		sCache := s.params.cache[paramKeys(model)[0]].Value.(tensor.Tensor)
 		assert.True(dawson.AllClose(correct, backingV, closef32))
 		assert.True(dawson.AllClose(cached, sCache.Data().([]float32), closef32))
 	}
@@ -0,0 +1,248 @@
+package gorgonia
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+	"gorgonia.org/tensor"
+)
+
+// SolverState is the internal state of a solver: the number of steps it has done and the
+// accumulators it keeps for every parameter of the model, keyed by the name of the parameter.
+// The parameters of a model holding an unnamed parameter, or two parameters of the same name,
+// are keyed by their position in the model.
+//
+// A SolverState only holds exported fields of plain types, so it can be encoded with encoding/gob or encoding/json.
+type SolverState struct {
+	Iter int
+	// LearnRate is the learn rate of the solvers adapting it, such as the BarzilaiBorweinSolver
+	LearnRate float64
+	Params    map[string]ParamState
+	// Schedule is the position of a Scheduler in its schedule, it is nil for the other solvers
+	Schedule *ScheduleState
+}
+
+// ParamState holds the accumulators kept by a solver for a single parameter. The accumulators
+// have the shape of the parameter; their meaning depends on the solver (the mean of the squared
+// gradients for RMSProp, the means and the variances of the gradients for Adam...)
+type ParamState struct {
+	Shape        tensor.Shape
+	Accumulators [][]float64
+}
+
+// StatefulSolver is a Solver whose state can be saved and restored, so a training can be resumed
+type StatefulSolver interface {
+	Solver
+	// State returns a copy of the state of the solver
+	State() (SolverState, error)
+	// SetState replaces the state of the solver. The accumulators are applied to the parameters
+	// of the same name at the next Step
+	SetState(SolverState) error
+}
+
+// solverParams keeps the accumulators of the parameters passed to Step, keyed as paramKeys does,
+// and the restored state waiting to be applied. As the accumulators of named parameters are looked
+// up by name at every Step, these parameters may be passed in any order
+type solverParams struct {
+	cache   map[string]*dualValue
+	pending map[string]ParamState
+}
+
+// paramKeys returns the keys of the accumulators of the parameters of model: their names if every
+// parameter implements Namer with a name of its own, their positions otherwise. Unnamed nodes
+// share the same name, so a model holding them, or holding two parameters of the same name, is
+// keyed by position like the solvers of upstream gorgonia, and must keep its order between steps
+func paramKeys(model []ValueGrad) []string {
+	keys := make([]string, len(model))
+	seen := make(map[string]bool, len(model))
+	for i, n := range model {
+		nm, ok := n.(Namer)
+		if !ok || seen[nm.Name()] {
+			for j := range keys {
+				keys[j] = strconv.Itoa(j)
+			}
+			return keys
+		}
+		keys[i] = nm.Name()
+		seen[keys[i]] = true
+	}
+	return keys
+}
+
+// cached returns the accumulators of the parameter of the given key: the ones of the previous steps,
+// the restored ones or zeroed ones for a parameter seen for the first time
+func (p *solverParams) cached(key string, n ValueGrad, weights, grad Value) (*dualValue, error) {
+	if cached, ok := p.cache[key]; ok {
+		return cached, nil
+	}
+	cached, err := p.newCache(key, n, weights, grad)
+	if err != nil {
+		return nil, err
+	}
+	if p.cache == nil {
+		p.cache = make(map[string]*dualValue)
+	}
+	p.cache[key] = cached
+	return cached, nil
+}
+
+// newCache returns the zeroed accumulators of the parameter of the given key, or the restored ones if any
+func (p *solverParams) newCache(key string, n ValueGrad, weights, grad Value) (*dualValue, error) {
+	cached, err := newCachedDV(n, weights, grad, true)
+	if err != nil {
+		return nil, err
+	}
+	ps, ok := p.pending[key]
+	if !ok {
+		return cached, nil
+	}
+	delete(p.pending, key)
+	if err := ps.restore(cached); err != nil {
+		return nil, errors.Wrapf(err, "Failed to restore the state of %v", key)
+	}
+	return cached, nil
+}
+
+// restoreAll restores the accumulators of every parameter of model, keyed by keys.
+// It fails if the state of a parameter is missing
+func (p *solverParams) restoreAll(model []ValueGrad, keys []string) error {
+	for i, n := range model {
+		if _, ok := p.pending[keys[i]]; !ok {
+			return errors.Errorf("No state to restore for %v", keys[i])
+		}
+		weights, grad, err := extractWeightGrad(n)
+		if err != nil {
+			return err
+		}
+		if _, err = p.cached(keys[i], n, weights, grad); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// state returns the accumulators of the parameters, along with the restored ones not applied yet
+func (p *solverParams) state(iter int) (SolverState, error) {
+	s := SolverState{
+		Iter:   iter,
+		Params: make(map[string]ParamState, len(p.cache)+len(p.pending)),
+	}
+	for name, ps := range p.pending {
+		s.Params[name] = ps
+	}
+	for name, cached := range p.cache {
+		ps, err := dualValueState(cached)
+		if err != nil {
+			return SolverState{}, errors.Wrapf(err, "Failed to save the state of %v", name)
+		}
+		s.Params[name] = ps
+	}
+	return s, nil
+}
+
+// setState drops the accumulators and keeps the ones of s until the parameters are seen by Step
+func (p *solverParams) setState(s SolverState) {
+	p.cache = nil
+	p.pending = make(map[string]ParamState, len(s.Params))
+	for name, ps := range s.Params {
+		p.pending[name] = ps
+	}
+}
+
+// dualValueState copies the value and the derivative of a cached dualValue
+func dualValueState(dv *dualValue) (ParamState, error) {
+	ps := ParamState{Shape: dv.Value.Shape().Clone()}
+	for _, v := range []Value{dv.Value, dv.d} {
+		data, err := valueData(v)
+		if err != nil {
+			return ParamState{}, err
+		}
+		ps.Accumulators = append(ps.Accumulators, data)
+	}
+	return ps, nil
+}
+
+// restore copies the accumulators into the value and the derivative of dv
+func (ps ParamState) restore(dv *dualValue) (err error) {
+	if len(ps.Accumulators) != 2 {
+		return errors.Errorf("Expected 2 accumulators, got %d", len(ps.Accumulators))
+	}
+	if !ps.Shape.Eq(dv.Value.Shape()) {
+		return errors.Errorf("Expected the shape %v, got %v", dv.Value.Shape(), ps.Shape)
+	}
+	if dv.Value, err = setValueData(dv.Value, ps.Accumulators[0]); err != nil {
+		return err
+	}
+	dv.d, err = setValueData(dv.d, ps.Accumulators[1])
+	return err
+}
+
+// restoreTensors copies the accumulators into ts, which must have the shape of the parameter
+func (ps ParamState) restoreTensors(ts ...tensor.Tensor) error {
+	if len(ps.Accumulators) != len(ts) {
+		return errors.Errorf("Expected %d accumulators, got %d", len(ts), len(ps.Accumulators))
+	}
+	for i, t := range ts {
+		if !ps.Shape.Eq(t.Shape()) {
+			return errors.Errorf("Expected the shape %v, got %v", t.Shape(), ps.Shape)
+		}
+		if _, err := setValueData(t, ps.Accumulators[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// valueData returns a copy of the data of v as float64
+func valueData(v Value) ([]float64, error) {
+	switch vt := v.(type) {
+	case *tensor.Dense:
+		switch data := vt.Data().(type) {
+		case []float64:
+			return append([]float64(nil), data...), nil
+		case []float32:
+			res := make([]float64, len(data))
+			for i, d := range data {
+				res[i] = float64(d)
+			}
+			return res, nil
+		}
+	case *F64:
+		return []float64{float64(*vt)}, nil
+	case *F32:
+		return []float64{float64(*vt)}, nil
+	}
+	return nil, errors.Errorf(nyiTypeFail, "valueData", v)
+}
+
+// setValueData copies data into v. Scalar values are copies, so the value to use is returned
+func setValueData(v Value, data []float64) (Value, error) {
+	switch vt := v.(type) {
+	case *tensor.Dense:
+		switch backing := vt.Data().(type) {
+		case []float64:
+			if len(backing) != len(data) {
+				break
+			}
+			copy(backing, data)
+			return v, nil
+		case []float32:
+			if len(backing) != len(data) {
+				break
+			}
+			for i, d := range data {
+				backing[i] = float32(d)
+			}
+			return v, nil
+		}
+	case *F64:
+		if len(data) == 1 {
+			return NewF64(data[0]), nil
+		}
+	case *F32:
+		if len(data) == 1 {
+			return NewF32(float32(data[0])), nil
+		}
+	}
+	return nil, errors.Errorf("Cannot restore %d values into %v", len(data), v)
+}
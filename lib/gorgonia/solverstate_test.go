@@ -0,0 +1,250 @@
+package gorgonia
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+
+	"gorgonia.org/tensor"
+)
+
+// stateModel is a quadratic model of two named parameters
+type stateModel struct {
+	params  Nodes
+	machine VM
+	// wrap, if set, replaces the parameters passed to the solver
+	wrap func(*Node) ValueGrad
+}
+
+// unnamed hides the name of a parameter from the solvers
+type unnamed struct{ ValueGrad }
+
+// renamed gives a parameter another name
+type renamed struct {
+	*Node
+	name string
+}
+
+func (r renamed) Name() string { return r.name }
+
+func newStateModel(t *testing.T, w, b []float64) *stateModel {
+	g := NewGraph()
+	wn := NewMatrix(g, Float64, WithShape(2, 2), WithName("w"), WithValue(tensor.New(tensor.WithShape(2, 2), tensor.WithBacking(append([]float64(nil), w...)))))
+	bn := NewVector(g, Float64, WithShape(2), WithName("b"), WithValue(tensor.New(tensor.WithShape(2), tensor.WithBacking(append([]float64(nil), b...)))))
+	x := NewConstant(tensor.New(tensor.WithShape(2), tensor.WithBacking([]float64{1, -2})), WithName("x"))
+	y := Must(Add(Must(Mul(wn, x)), bn))
+	cost := Must(Sum(Must(Square(Must(Sub(y, x))))))
+	if _, err := Grad(cost, wn, bn); err != nil {
+		t.Fatal(err)
+	}
+	return &stateModel{
+		params:  Nodes{wn, bn},
+		machine: NewTapeMachine(g, BindDualValues(wn, bn)),
+	}
+}
+
+// newTwinModel returns a model of two named parameters of the same shape, whose accumulators
+// could be swapped without any error
+func newTwinModel(t *testing.T) *stateModel {
+	g := NewGraph()
+	u := NewVector(g, Float64, WithShape(2), WithName("u"), WithValue(tensor.New(tensor.WithShape(2), tensor.WithBacking([]float64{0.5, -0.5}))))
+	v := NewVector(g, Float64, WithShape(2), WithName("v"), WithValue(tensor.New(tensor.WithShape(2), tensor.WithBacking([]float64{0.1, 2}))))
+	x := NewConstant(tensor.New(tensor.WithShape(2), tensor.WithBacking([]float64{1, -2})), WithName("x"))
+	y := Must(Add(Must(HadamardProd(u, x)), v))
+	cost := Must(Sum(Must(Square(Must(Sub(y, x))))))
+	if _, err := Grad(cost, u, v); err != nil {
+		t.Fatal(err)
+	}
+	return &stateModel{
+		params:  Nodes{u, v},
+		machine: NewTapeMachine(g, BindDualValues(u, v)),
+	}
+}
+
+// step runs the model and updates the parameters, in the given order of the params
+func (m *stateModel) step(t *testing.T, solver Solver, order ...int) {
+	m.machine.Reset()
+	if err := m.machine.RunAll(); err != nil {
+		t.Fatal(err)
+	}
+	model := make([]ValueGrad, len(order))
+	for i, o := range order {
+		model[i] = m.params[o]
+		if m.wrap != nil {
+			model[i] = m.wrap(m.params[o])
+		}
+	}
+	if err := solver.Step(model); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (m *stateModel) values() ([]float64, []float64) {
+	w := m.params[0].Value().Data().([]float64)
+	b := m.params[1].Value().Data().([]float64)
+	return append([]float64(nil), w...), append([]float64(nil), b...)
+}
+
+func TestSolverState(t *testing.T) {
+	solvers := map[string]func() StatefulSolver{
+		"RMSProp":         func() StatefulSolver { return NewRMSPropSolver(WithLearnRate(0.01)) },
+		"Adam":            func() StatefulSolver { return NewAdamSolver(WithLearnRate(0.01)) },
+		"Vanilla":         func() StatefulSolver { return NewVanillaSolver(WithLearnRate(0.01)) },
+		"Momentum":        func() StatefulSolver { return NewMomentum(WithLearnRate(0.01)) },
+		"AdaGrad":         func() StatefulSolver { return NewAdaGradSolver(WithLearnRate(0.01)) },
+		"BarzilaiBorwein": func() StatefulSolver { return NewBarzilaiBorweinSolver(WithLearnRate(0.01)) },
+		"AdamW":           func() StatefulSolver { return NewAdamW(WithLearnRate(0.01)) },
+	}
+	codecs := map[string]func(SolverState) (SolverState, error){
+		"gob": func(s SolverState) (res SolverState, err error) {
+			var buf bytes.Buffer
+			if err = gob.NewEncoder(&buf).Encode(s); err != nil {
+				return
+			}
+			err = gob.NewDecoder(&buf).Decode(&res)
+			return
+		},
+		"json": func(s SolverState) (res SolverState, err error) {
+			var data []byte
+			if data, err = json.Marshal(s); err != nil {
+				return
+			}
+			err = json.Unmarshal(data, &res)
+			return
+		},
+	}
+	for name, newSolver := range solvers {
+		for codec, roundTrip := range codecs {
+			t.Run(name+"/"+codec, func(t *testing.T) {
+				original := newStateModel(t, []float64{0.5, -0.5, 1, 2}, []float64{0.1, -0.1})
+				solver := newSolver()
+				// the Barzilai-Borwein solver reaches the minimum of the model after a few steps
+				for i := 0; i < 2; i++ {
+					original.step(t, solver, 0, 1)
+				}
+				state, err := solver.State()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, isVanilla := solver.(*VanillaSolver); !isVanilla && len(state.Params) != 2 {
+					t.Fatalf("expected the state of 2 parameters, got %v", state.Params)
+				}
+				if state, err = roundTrip(state); err != nil {
+					t.Fatal(err)
+				}
+
+				// the parameters of the restored model are passed in another order
+				w, b := original.values()
+				restored := newStateModel(t, w, b)
+				resumed := newSolver()
+				if err := resumed.SetState(state); err != nil {
+					t.Fatal(err)
+				}
+				for i := 0; i < 2; i++ {
+					original.step(t, solver, 0, 1)
+					restored.step(t, resumed, 1, 0)
+				}
+				w, b = original.values()
+				rw, rb := restored.values()
+				for i := range w {
+					if w[i] != rw[i] {
+						t.Fatalf("w: expected %v, got %v", w, rw)
+					}
+				}
+				for i := range b {
+					if b[i] != rb[i] {
+						t.Fatalf("b: expected %v, got %v", b, rb)
+					}
+				}
+				expected, _ := solver.State()
+				got, err := resumed.State()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if expected.Iter != got.Iter || expected.LearnRate != got.LearnRate || len(expected.Params) != len(got.Params) {
+					t.Fatalf("expected the state %+v, got %+v", expected, got)
+				}
+				for param, ps := range expected.Params {
+					if !ps.Shape.Eq(got.Params[param].Shape) {
+						t.Fatalf("%v: expected the shape %v, got %v", param, ps.Shape, got.Params[param].Shape)
+					}
+					for i, acc := range ps.Accumulators {
+						for j, v := range acc {
+							if got.Params[param].Accumulators[i][j] != v {
+								t.Fatalf("%v: expected the accumulators %v, got %v", param, ps.Accumulators, got.Params[param].Accumulators)
+							}
+						}
+					}
+				}
+
+				// the same solver is then passed the parameters in another order, and
+				// must update them as the solver always passed them in the same order
+				twins, reference := newTwinModel(t), newTwinModel(t)
+				solver, referenceSolver := newSolver(), newSolver()
+				twins.step(t, solver, 0, 1)
+				reference.step(t, referenceSolver, 0, 1)
+				for i := 0; i < 2; i++ {
+					twins.step(t, solver, 1, 0)
+					reference.step(t, referenceSolver, 0, 1)
+				}
+				u, v := twins.values()
+				ru, rv := reference.values()
+				for i := range u {
+					if u[i] != ru[i] || v[i] != rv[i] {
+						t.Fatalf("expected %v and %v, got %v and %v", ru, rv, u, v)
+					}
+				}
+
+				// the unnamed parameters and the parameters of the same name keep accumulators of their own
+				wraps := map[string]func(*Node) ValueGrad{
+					"unnamed":   func(n *Node) ValueGrad { return unnamed{n} },
+					"same name": func(n *Node) ValueGrad { return renamed{n, "p"} },
+				}
+				for kind, wrap := range wraps {
+					twins := newTwinModel(t)
+					twins.wrap = wrap
+					solver := newSolver()
+					for i := 0; i < 3; i++ {
+						twins.step(t, solver, 0, 1)
+					}
+					state, err := solver.State()
+					if err != nil {
+						t.Fatal(err)
+					}
+					if _, isVanilla := solver.(*VanillaSolver); !isVanilla && len(state.Params) != 2 {
+						t.Fatalf("%v: expected the state of 2 parameters, got %v", kind, len(state.Params))
+					}
+					u, v := twins.values()
+					for i := range u {
+						if u[i] != ru[i] || v[i] != rv[i] {
+							t.Fatalf("%v: expected %v and %v, got %v and %v", kind, ru, rv, u, v)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSolverStateMismatch(t *testing.T) {
+	m := newStateModel(t, []float64{0.5, -0.5, 1, 2}, []float64{0.1, -0.1})
+	solver := NewRMSPropSolver()
+	err := solver.SetState(SolverState{Params: map[string]ParamState{
+		"w": {Shape: tensor.Shape{4}, Accumulators: [][]float64{make([]float64, 4), make([]float64, 4)}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.machine.Reset()
+	if err := m.machine.RunAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := solver.Step(NodesToValueGrads(m.params)); err == nil {
+		t.Fatal("expected an error when restoring accumulators of another shape")
+	}
+
+	if err := NewVanillaSolver().SetState(SolverState{Params: map[string]ParamState{"w": {}}}); err == nil {
+		t.Fatal("the VanillaSolver should not accept accumulators")
+	}
+}
@@ -0,0 +1,125 @@
+package lstm
+
+import (
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+// batchParams holds the weights arranged for a batched step: the matrices are transposed
+// and the biases are (1 × n) rows broadcast over the batch
+type batchParams struct {
+	wi, ui, biasI *G.Node
+	wf, uf, biasF *G.Node
+	wo, uo, biasO *G.Node
+	wc, uc, biasC *G.Node
+	wy, biasY     *G.Node
+}
+
+func (l *lstm) batchParams() (*batchParams, error) {
+	var err error
+	p := new(batchParams)
+	transpose := func(src *G.Node) *G.Node {
+		if err != nil {
+			return nil
+		}
+		var n *G.Node
+		n, err = G.Transpose(src)
+		return n
+	}
+	row := func(src *G.Node) *G.Node {
+		if err != nil {
+			return nil
+		}
+		var n *G.Node
+		n, err = G.Reshape(src, tensor.Shape{1, src.Shape().TotalSize()})
+		return n
+	}
+	p.wi, p.ui, p.biasI = transpose(l.wi), transpose(l.ui), row(l.biasI)
+	p.wf, p.uf, p.biasF = transpose(l.wf), transpose(l.uf), row(l.biasF)
+	p.wo, p.uo, p.biasO = transpose(l.wo), transpose(l.uo), row(l.biasO)
+	p.wc, p.uc, p.biasC = transpose(l.wc), transpose(l.uc), row(l.biasC)
+	p.wy, p.biasY = transpose(l.wy), row(l.biasY)
+	return p, err
+}
+
+// batchStep is the batched version of step: x is a (B × inputSize) matrix holding one input per row,
+// prevHidden and prevCell are (B × hiddenSize) matrices and y is a (B × outputSize) matrix.
+// If outputDrop is not nil, it is the (B × hiddenSize) dropout mask of hₜ before Wy
+//
+//	iₜ = σ(xₜ·Wᵢᵀ+hₜ₋₁·Uᵢᵀ+Bᵢ)
+//	...
+//	yₜ = softmax(hₜ·Wyᵀ+By)
+func (p *batchParams) batchStep(x, prevHidden, prevCell, outputDrop *G.Node) (hidden, cell, y *G.Node, err error) {
+	// gate computes activation(xₜ·Wᵀ+hₜ₋₁·Uᵀ+B)
+	gate := func(w, u, b *G.Node, activation func(*G.Node) (*G.Node, error)) (*G.Node, error) {
+		xw, err := G.Mul(x, w)
+		if err != nil {
+			return nil, err
+		}
+		hu, err := G.Mul(prevHidden, u)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := G.Add(xw, hu)
+		if err != nil {
+			return nil, err
+		}
+		if sum, err = G.BroadcastAdd(sum, b, nil, []byte{0}); err != nil {
+			return nil, err
+		}
+		return activation(sum)
+	}
+	var i, f, o, candidate *G.Node
+	if i, err = gate(p.wi, p.ui, p.biasI, G.Sigmoid); err != nil {
+		return nil, nil, nil, err
+	}
+	if f, err = gate(p.wf, p.uf, p.biasF, G.Sigmoid); err != nil {
+		return nil, nil, nil, err
+	}
+	if o, err = gate(p.wo, p.uo, p.biasO, G.Sigmoid); err != nil {
+		return nil, nil, nil, err
+	}
+	if candidate, err = gate(p.wc, p.uc, p.biasC, G.Tanh); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// cₜ = fₜ*cₜ₋₁ + iₜ*ĉₜ
+	var forget, write *G.Node
+	if forget, err = G.HadamardProd(f, prevCell); err != nil {
+		return nil, nil, nil, err
+	}
+	if write, err = G.HadamardProd(i, candidate); err != nil {
+		return nil, nil, nil, err
+	}
+	if cell, err = G.Add(forget, write); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// hₜ = oₜ*tanh(cₜ)
+	var tanhCell *G.Node
+	if tanhCell, err = G.Tanh(cell); err != nil {
+		return nil, nil, nil, err
+	}
+	if hidden, err = G.HadamardProd(o, tanhCell); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// yₜ = softmax(hₜ·Wyᵀ+By), row by row
+	out := hidden
+	if outputDrop != nil {
+		if out, err = G.HadamardProd(hidden, outputDrop); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	var hw, logits *G.Node
+	if hw, err = G.Mul(out, p.wy); err != nil {
+		return nil, nil, nil, err
+	}
+	if logits, err = G.BroadcastAdd(hw, p.biasY, nil, []byte{0}); err != nil {
+		return nil, nil, nil, err
+	}
+	if y, err = G.SoftMax(logits); err != nil {
+		return nil, nil, nil, err
+	}
+	return hidden, cell, y, nil
+}
@@ -0,0 +1,178 @@
+package lstm
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+)
+
+// BeamConfig holds the parameters of the beam search
+type BeamConfig struct {
+	// Width is the number of partial answers (K) kept at each step
+	Width int
+	// NBest is the number of answers returned. It defaults to Width
+	NBest int
+	// MaxLength is the maximum number of generated tokens, it must be positive
+	MaxLength int
+	// EOS holds the indices of the tokens ending an answer
+	EOS []int
+	// LengthPenalty is the α of the length normalization: the score of an answer
+	// is its log-probability divided by ((5+length)/6)^α. Zero disables the normalization
+	LengthPenalty float64
+}
+
+// Hypothesis is an answer found by the beam search
+type Hypothesis struct {
+	// Tokens are the indices of the generated tokens, without the end of sequence token
+	Tokens []int
+	// LogProb is the accumulated log-probability of the tokens (end of sequence included)
+	LogProb float64
+	// Score is the length normalized log-probability used to rank the hypotheses
+	Score float64
+	// Finished is true if the hypothesis ended with an end of sequence token
+	Finished bool
+}
+
+// beam is a partial answer with the memory of the model after its last token
+type beam struct {
+	tokens  []int
+	logProb float64
+	hidden  []float32
+	cell    []float32
+	probs   []float32
+}
+
+// BeamSearch feeds the prompt to the model and searches the answers with the highest probability.
+// It keeps config.Width partial answers, each one with its own copy of the hidden and cell states,
+// and returns at most config.NBest hypotheses sorted by decreasing score
+func (m *Model) BeamSearch(ctx context.Context, prompt []int, config BeamConfig) ([]Hypothesis, error) {
+	if config.Width <= 0 {
+		return nil, errors.New("the beam width must be positive")
+	}
+	if config.MaxLength <= 0 {
+		return nil, errors.New("the maximum length must be positive")
+	}
+	if len(prompt) == 0 {
+		return nil, errors.New("empty prompt")
+	}
+	if config.NBest <= 0 {
+		config.NBest = config.Width
+	}
+	eos := make(map[int]bool, len(config.EOS))
+	for _, idx := range config.EOS {
+		eos[idx] = true
+	}
+	score := func(logProb float64, length int) float64 {
+		if config.LengthPenalty == 0 {
+			return logProb
+		}
+		return logProb / math.Pow((5+float64(length))/6, config.LengthPenalty)
+	}
+
+	stepper, err := m.newStepper()
+	if err != nil {
+		return nil, err
+	}
+	input := make([]float32, m.inputSize)
+	oneHot := func(idx int) []float32 {
+		for i := range input {
+			input[i] = 0
+		}
+		input[idx] = 1
+		return input
+	}
+	var output []float32
+	for _, idx := range prompt {
+		if idx < 0 || idx >= m.inputSize {
+			return nil, errors.New("prompt token out of the vocabulary")
+		}
+		if output, err = stepper.step(oneHot(idx)); err != nil {
+			return nil, err
+		}
+	}
+	first := &beam{
+		probs: append([]float32(nil), output...),
+	}
+	first.hidden, first.cell = stepper.state()
+	beams := []*beam{first}
+
+	var finished []Hypothesis
+	for length := 1; length <= config.MaxLength && len(beams) > 0 && len(finished) < config.Width; length++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		type candidate struct {
+			parent  *beam
+			token   int
+			logProb float64
+		}
+		var candidates []candidate
+		for _, b := range beams {
+			for token, p := range b.probs {
+				if p <= 0 {
+					continue
+				}
+				candidates = append(candidates, candidate{
+					parent:  b,
+					token:   token,
+					logProb: b.logProb + math.Log(float64(p)),
+				})
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].logProb > candidates[j].logProb
+		})
+
+		next := make([]*beam, 0, config.Width)
+		for _, c := range candidates {
+			if len(next) >= config.Width {
+				break
+			}
+			if eos[c.token] {
+				finished = append(finished, Hypothesis{
+					Tokens:   c.parent.tokens,
+					LogProb:  c.logProb,
+					Score:    score(c.logProb, length),
+					Finished: true,
+				})
+				if len(finished) >= config.Width {
+					break
+				}
+				continue
+			}
+			stepper.setState(c.parent.hidden, c.parent.cell)
+			if output, err = stepper.step(oneHot(c.token)); err != nil {
+				return nil, err
+			}
+			b := &beam{
+				tokens:  append(append(make([]int, 0, length), c.parent.tokens...), c.token),
+				logProb: c.logProb,
+				probs:   append([]float32(nil), output...),
+			}
+			b.hidden, b.cell = stepper.state()
+			next = append(next, b)
+		}
+		beams = next
+	}
+
+	// Partial answers are only used when not enough answers have ended
+	if len(finished) < config.NBest {
+		for _, b := range beams {
+			finished = append(finished, Hypothesis{
+				Tokens:  b.tokens,
+				LogProb: b.logProb,
+				Score:   score(b.logProb, len(b.tokens)),
+			})
+		}
+	}
+	sort.SliceStable(finished, func(i, j int) bool {
+		return finished[i].Score > finished[j].Score
+	})
+	if len(finished) > config.NBest {
+		finished = finished[:config.NBest]
+	}
+	return finished, nil
+}
@@ -0,0 +1,70 @@
+package lstm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/owulveryck/lstm/datasetter/char"
+	G "gorgonia.org/gorgonia"
+)
+
+func TestBeamSearch(t *testing.T) {
+	tokens := []string{"\n", "a", "b", "c", "d"}
+	back := testBackends(len(tokens), len(tokens), 10)
+	back.Wy = G.Gaussian32(0.0, 1, len(tokens), 10)
+	back.Wi = G.Gaussian32(0.0, 1, 10, len(tokens))
+	back.Wo = G.Gaussian32(0.0, 1, 10, len(tokens))
+	back.Wc = G.Gaussian32(0.0, 1, 10, len(tokens))
+	model := newModelFromBackends(back)
+
+	config := BeamConfig{
+		Width:         3,
+		NBest:         2,
+		MaxLength:     6,
+		EOS:           []int{0},
+		LengthPenalty: 0.6,
+	}
+	hypotheses, err := model.BeamSearch(context.TODO(), []int{1, 2}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hypotheses) == 0 || len(hypotheses) > config.NBest {
+		t.Fatalf("expected between 1 and %v hypotheses, got %v", config.NBest, len(hypotheses))
+	}
+	for i, h := range hypotheses {
+		if len(h.Tokens) > config.MaxLength {
+			t.Fatalf("hypothesis too long: %v", h.Tokens)
+		}
+		for _, tk := range h.Tokens {
+			if tk == 0 {
+				t.Fatalf("the end of sequence should not be part of the answer: %v", h.Tokens)
+			}
+		}
+		if i > 0 && h.Score > hypotheses[i-1].Score {
+			t.Fatal("hypotheses are not sorted by score")
+		}
+	}
+
+	// the zero value of MaxLength would never generate any token
+	if _, err := model.BeamSearch(context.TODO(), []int{1, 2}, BeamConfig{Width: 3}); err == nil {
+		t.Fatal("expected an error without a maximum length")
+	}
+
+	// a beam of width 1 without normalization is a greedy search
+	greedy, err := model.BeamSearch(context.TODO(), []int{1, 2}, BeamConfig{Width: 1, MaxLength: 6, EOS: []int{0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prediction := char.NewPrediction("a b", testVocab(tokens...), 6, len(tokens))
+	if err := model.Predict(context.TODO(), prediction); err != nil {
+		t.Fatal(err)
+	}
+	if len(greedy) != 1 || len(greedy[0].Tokens) != len(prediction.GetOutput()) {
+		t.Fatalf("beam of width 1 %v differs from the greedy prediction %v", greedy, prediction.GetOutput())
+	}
+	for i, output := range prediction.GetOutput() {
+		if output[greedy[0].Tokens[i]] != 1 {
+			t.Fatalf("beam of width 1 %v differs from the greedy prediction %v", greedy[0].Tokens, prediction.GetOutput())
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package lstm
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/owulveryck/lstm/datasetter"
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+// batchShape is the key of a compiled graph
+type batchShape struct {
+	size   int
+	seqLen int
+}
+
+// graphCache holds the graphs compiled for a training
+type graphCache struct {
+	graphs map[batchShape]*compiledLSTM
+	// eos holds the expected tokens after which the memory is reset.
+	// When it is empty the memory is carried along the sequences
+	eos map[int]bool
+	// dropout is compiled in the graphs; masks draws the dropout masks of the next step
+	dropout Dropout
+	masks   *rand.Rand
+}
+
+func newGraphCache(eos ...int) *graphCache {
+	c := &graphCache{
+		graphs: make(map[batchShape]*compiledLSTM),
+	}
+	if len(eos) > 0 {
+		c.eos = make(map[int]bool, len(eos))
+		for _, idx := range eos {
+			c.eos[idx] = true
+		}
+	}
+	return c
+}
+
+// compiledLSTM is the graph of the model unrolled for batches of a fixed size and a fixed sequence length.
+// It is built and compiled once; a training step only rebinds the input values,
+// the expected values and the initial memory before running the tape
+type compiledLSTM struct {
+	lstm      *lstm
+	batchSize int
+	seqLen    int
+	// (B × inputSize) one-hot encoded inputs and (B × outputSize) expected outputs, one per time step.
+	// The expected output of a padded position is all zeros so it does not add to the cost
+	inputs  G.Nodes
+	targets G.Nodes
+	// (B × hiddenSize) initial memory
+	prevHidden *G.Node
+	prevCell   *G.Node
+	// keeps are (B × hiddenSize) masks multiplying the memory before each step but the first one.
+	// A row is set to zero to reset the memory of a sequence; keeps is nil if the graph never resets
+	keeps G.Nodes
+	// scale multiplies the loss summed over the batch
+	scale *G.Node
+	// the dropout masks, nil if their probability is zero: inputDrops are (B × inputSize) and outputDrops
+	// (B × hiddenSize) masks of every time step, recurrentDrop is the (B × hiddenSize) mask of hₜ₋₁ shared by the time steps
+	dropout       Dropout
+	inputDrops    G.Nodes
+	outputDrops   G.Nodes
+	recurrentDrop *G.Node
+
+	cost   *G.Node
+	hidden *G.Node
+	cell   *G.Node
+
+	learnables G.Nodes
+	machine    G.VM
+}
+
+// compile unrolls the graph of the model for batches of batchSize sequences of seqLen inputs and compiles it.
+// If resets is true, the memory of a sequence can be reset between two steps. The units are dropped as set by dropout
+func (m *Model) compile(batchSize, seqLen int, resets bool, dropout Dropout) (*compiledLSTM, error) {
+	if batchSize <= 0 || seqLen <= 0 {
+		return nil, errors.New("cannot compile an empty batch")
+	}
+	hiddenT := tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(m.hiddenSize))
+	cellT := tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(m.hiddenSize))
+	l := m.newLSTM(hiddenT, cellT)
+	c := &compiledLSTM{
+		lstm:      l,
+		batchSize: batchSize,
+		seqLen:    seqLen,
+		inputs:    make(G.Nodes, seqLen),
+		targets:   make(G.Nodes, seqLen),
+		dropout:   dropout,
+	}
+	matrix := func(name string, cols int) *G.Node {
+		t := tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(batchSize, cols))
+		return G.NewMatrix(l.g, tensor.Float32, G.WithName(name), G.WithShape(batchSize, cols), G.WithValue(t))
+	}
+	for i := 0; i < seqLen; i++ {
+		c.inputs[i] = matrix(fmt.Sprintf("input_%v", i), m.inputSize)
+		c.targets[i] = matrix(fmt.Sprintf("target_%v", i), m.outputSize)
+	}
+	c.prevHidden = matrix("Hₜ₋₁", m.hiddenSize)
+	c.prevCell = matrix("Cₜ₋₁", m.hiddenSize)
+	c.scale = G.NewScalar(l.g, tensor.Float32, G.WithName("scale"), G.WithValue(float32(1)))
+	if resets {
+		c.keeps = make(G.Nodes, seqLen)
+		for i := 1; i < seqLen; i++ {
+			c.keeps[i] = matrix(fmt.Sprintf("keep_%v", i), m.hiddenSize)
+		}
+	}
+	c.inputDrops = dropoutMasks(dropout.Input, seqLen, func(i int) *G.Node {
+		return matrix(fmt.Sprintf("input_drop_%v", i), m.inputSize)
+	})
+	c.outputDrops = dropoutMasks(dropout.Output, seqLen, func(i int) *G.Node {
+		return matrix(fmt.Sprintf("output_drop_%v", i), m.hiddenSize)
+	})
+	if dropout.Recurrent > 0 {
+		c.recurrentDrop = matrix("recurrent_drop", m.hiddenSize)
+	}
+
+	params, err := l.batchParams()
+	if err != nil {
+		return nil, err
+	}
+	hidden, cell := c.prevHidden, c.prevCell
+	var loss *G.Node
+	for i := 0; i < seqLen; i++ {
+		var y *G.Node
+		if c.keeps != nil && i > 0 {
+			hidden = G.Must(G.HadamardProd(hidden, c.keeps[i]))
+			cell = G.Must(G.HadamardProd(cell, c.keeps[i]))
+		}
+		x, gateHidden := c.inputs[i], hidden
+		if c.inputDrops != nil {
+			x = G.Must(G.HadamardProd(x, c.inputDrops[i]))
+		}
+		if c.recurrentDrop != nil {
+			gateHidden = G.Must(G.HadamardProd(hidden, c.recurrentDrop))
+		}
+		var outputDrop *G.Node
+		if c.outputDrops != nil {
+			outputDrop = c.outputDrops[i]
+		}
+		if hidden, cell, y, err = params.batchStep(x, gateHidden, cell, outputDrop); err != nil {
+			return nil, err
+		}
+		// The expected values are one-hot encoded, so Σ target⊙log(y) is the sum of the log(y) of the expected outputs
+		stepLoss := G.Must(G.Sum(G.Must(G.HadamardProd(c.targets[i], G.Must(G.Log(y))))))
+		if loss == nil {
+			loss = stepLoss
+			continue
+		}
+		loss = G.Must(G.Add(loss, stepLoss))
+	}
+	c.hidden, c.cell = hidden, cell
+	c.cost = G.Must(G.Neg(G.Must(G.Mul(loss, c.scale))))
+	G.WithName("Cost")(c.cost)
+	c.learnables = l.learnables()
+	if _, err = G.Grad(c.cost, c.learnables...); err != nil {
+		return nil, err
+	}
+	c.machine = G.NewTapeMachine(l.g, G.BindDualValues(c.learnables...))
+	return c, nil
+}
+
+// bind sets the values of the inputs, the expected values and the (B × hiddenSize) initial memory.
+// The cost of the run is the loss of the unmasked tokens multiplied by scale.
+// If the graph resets, the memory of a sequence is reset after the positions expecting a token of eos.
+// If the graph drops units, its masks are drawn from masks
+func (c *compiledLSTM) bind(batch *datasetter.Batch, scale float32, hidden, cell []float32, eos map[int]bool, masks *rand.Rand) error {
+	if shape := batch.Inputs.Shape(); len(shape) != 2 || shape[0] != c.batchSize || shape[1] != c.seqLen {
+		return fmt.Errorf("batch of shape %v bound to a graph compiled for (%v, %v)", shape, c.batchSize, c.seqLen)
+	}
+	inputs := batch.Inputs.Data().([]int)
+	targets := batch.Targets.Data().([]int)
+	mask := batch.Mask.Data().([]float32)
+	for i := 0; i < c.seqLen; i++ {
+		inputBacking := c.inputs[i].Value().Data().([]float32)
+		targetBacking := c.targets[i].Value().Data().([]float32)
+		inputSize := len(inputBacking) / c.batchSize
+		outputSize := len(targetBacking) / c.batchSize
+		for b := 0; b < c.batchSize; b++ {
+			offset := b*c.seqLen + i
+			oneHot(inputBacking[b*inputSize:(b+1)*inputSize], inputs[offset])
+			target := targets[offset]
+			if mask[offset] == 0 {
+				target = -1
+			}
+			oneHot(targetBacking[b*outputSize:(b+1)*outputSize], target)
+			if c.keeps == nil || i == 0 {
+				continue
+			}
+			keepBacking := c.keeps[i].Value().Data().([]float32)
+			hiddenSize := len(keepBacking) / c.batchSize
+			keep := float32(1)
+			if previous := offset - 1; mask[previous] != 0 && eos[targets[previous]] {
+				keep = 0
+			}
+			for j := b * hiddenSize; j < (b+1)*hiddenSize; j++ {
+				keepBacking[j] = keep
+			}
+		}
+	}
+	if c.dropout.enabled() {
+		if masks == nil {
+			return errors.New("no source to draw the dropout masks from")
+		}
+		for i := range c.inputDrops {
+			fillMask(masks, c.inputDrops[i].Value().Data().([]float32), c.dropout.Input)
+		}
+		for i := range c.outputDrops {
+			fillMask(masks, c.outputDrops[i].Value().Data().([]float32), c.dropout.Output)
+		}
+		if c.recurrentDrop != nil {
+			fillMask(masks, c.recurrentDrop.Value().Data().([]float32), c.dropout.Recurrent)
+		}
+	}
+	if err := G.Let(c.scale, G.NewF32(scale)); err != nil {
+		return err
+	}
+	copy(c.prevHidden.Value().Data().([]float32), hidden)
+	copy(c.prevCell.Value().Data().([]float32), cell)
+	return nil
+}
+
+// run executes the forward and backward passes for the bound values, calls read
+// while the computed values are available, and updates the weights with solver
+func (c *compiledLSTM) run(read func(), solver G.Solver) error {
+	defer c.machine.Reset()
+	if err := c.machine.RunAll(); err != nil {
+		return err
+	}
+	if read != nil {
+		read()
+	}
+	return solver.Step(G.NodesToValueGrads(c.learnables))
+}
+
+// sequenceBatch returns the sequence of trainer as a batch of size one where the ignored positions are masked
+func sequenceBatch(trainer datasetter.IndexTrainer) (*datasetter.Batch, error) {
+	n := trainer.Len()
+	inputs := make([]int, n)
+	targets := make([]int, n)
+	mask := make([]float32, n)
+	for i := 0; i < n; i++ {
+		var err error
+		if inputs[i], err = trainer.GetInputValue(i); err != nil {
+			return nil, err
+		}
+		if targets[i], err = trainer.GetExpectedValue(i); err != nil {
+			return nil, err
+		}
+		if targets[i] != datasetter.Ignore {
+			mask[i] = 1
+		}
+	}
+	return datasetter.NewBatch(1, n, inputs, targets, mask), nil
+}
+
+// oneHot sets backing to the one-hot encoding of idx
+func oneHot(backing []float32, idx int) {
+	for i := range backing {
+		backing[i] = 0
+	}
+	if idx >= 0 && idx < len(backing) {
+		backing[idx] = 1
+	}
+}
+
+// learnables returns the weights and biases of the cell in the order used by the solver
+func (l *lstm) learnables() G.Nodes {
+	return G.Nodes{
+		l.biasC, l.biasF, l.biasI, l.biasO, l.biasY,
+		l.uc, l.uf, l.ui, l.uo,
+		l.wc, l.wf, l.wi, l.wo, l.wy,
+	}
+}
@@ -0,0 +1,274 @@
+package lstm
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/owulveryck/lstm/datasetter"
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+// indexSet exposes the indices of a testSet so it can be bound to a compiled graph
+type indexSet struct {
+	*testSet
+}
+
+func (s indexSet) Len() int {
+	return len(s.values)
+}
+
+func (s indexSet) GetInputValue(offset int) (int, error) {
+	for i, v := range s.values[offset] {
+		if v == 1 {
+			return i, nil
+		}
+	}
+	return 0, nil
+}
+
+func newTestSet() *testSet {
+	return &testSet{
+		values: [][]float32{
+			{1, 0, 0, 0, 0},
+			{0, 1, 0, 0, 0},
+			{0, 0, 1, 0, 0},
+			{0, 0, 0, 1, 0},
+			{0, 0, 0, 0, 1},
+		},
+		expectedValues: []int{1, 2, 3, 4, 0},
+	}
+}
+
+func cloneBackends(b *backends) *backends {
+	c := *b
+	for _, s := range []*[]float32{
+		&c.Wi, &c.Ui, &c.BiasI, &c.Wf, &c.Uf, &c.BiasF,
+		&c.Wo, &c.Uo, &c.BiasO, &c.Wc, &c.Uc, &c.BiasC, &c.Wy, &c.BiasY,
+	} {
+		*s = append([]float32(nil), *s...)
+	}
+	return &c
+}
+
+func TestCompiledTrainStep(t *testing.T) {
+	// the batched graph does not sum the products in the same order as the vector one, so the gradients
+	// differ by the rounding of the float32 sums. RMSProp starts with a nearly empty mean of the squared
+	// gradients: its first updates are about lr/sqrt(1-decay), 30 times the learn rate. With a learn rate
+	// of 0.1 the weights jump by 3 and the two trainings amplify the rounding until they diverge; with its
+	// usual learn rate of 1e-3, they stay within 1e-7 as with the vanilla solver
+	solvers := []struct {
+		name      string
+		new       func() G.Solver
+		tolerance float64
+	}{
+		{"vanilla", func() G.Solver {
+			return G.NewVanillaSolver(G.WithLearnRate(0.1), G.WithL2Reg(1e-6), G.WithClip(5))
+		}, 1e-4},
+		{"rmsprop", func() G.Solver {
+			return G.NewRMSPropSolver(G.WithLearnRate(1e-3), G.WithL2Reg(1e-6), G.WithClip(5))
+		}, 1e-4},
+	}
+	for _, solver := range solvers {
+		hiddenSize := 10
+		back := testBackends(5, 5, hiddenSize)
+		rebuilt := newModelFromBackends(back)
+		compiled := newModelFromBackends(cloneBackends(back))
+		rebuiltSolver, compiledSolver := solver.new(), solver.new()
+		graphs := newGraphCache()
+		newState := func() (tensor.Tensor, tensor.Tensor) {
+			return tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(hiddenSize)),
+				tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(hiddenSize))
+		}
+		rebuiltHidden, rebuiltCell := newState()
+		compiledHidden, compiledCell := newState()
+		// both graphs learn the mean of the loss of the tokens, as the model evaluates it
+		evaluation, err := rebuilt.Evaluate(context.Background(), &finiteSet{sequenceSet: sequenceSet{inputs: []int{0, 1, 2, 3, 4}, targets: []int{1, 2, 3, 4, 0}}, count: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 5; i++ {
+			rebuiltCost, rebuiltPerp, err := rebuilt.trainStep(newTestSet(), rebuiltSolver, nil, rebuiltHidden, rebuiltCell)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compiledCost, compiledPerp, err := compiled.trainStep(indexSet{newTestSet()}, compiledSolver, graphs, compiledHidden, compiledCell)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(float64(rebuiltCost-compiledCost)) > solver.tolerance || math.Abs(float64(rebuiltPerp-compiledPerp)) > solver.tolerance {
+				t.Fatalf("%v, step %v: cost %v/%v and perplexity %v/%v differ", solver.name, i, rebuiltCost, compiledCost, rebuiltPerp, compiledPerp)
+			}
+			if i == 0 && math.Abs(float64(compiledCost-evaluation.Loss)) > solver.tolerance {
+				t.Fatalf("%v: the cost %v is not the mean loss %v", solver.name, compiledCost, evaluation.Loss)
+			}
+		}
+		if len(graphs.graphs) != 1 {
+			t.Fatalf("%v: the graph should be compiled once, got %v graphs", solver.name, len(graphs.graphs))
+		}
+		for i := range rebuilt.wy {
+			if math.Abs(float64(rebuilt.wy[i]-compiled.wy[i])) > solver.tolerance {
+				t.Fatalf("%v: weights differ: %v/%v", solver.name, rebuilt.wy[i], compiled.wy[i])
+			}
+		}
+		for i := range rebuilt.ui {
+			if math.Abs(float64(rebuilt.ui[i]-compiled.ui[i])) > solver.tolerance {
+				t.Fatalf("%v: weights differ: %v/%v", solver.name, rebuilt.ui[i], compiled.ui[i])
+			}
+		}
+	}
+}
+
+// TestCompiledGradient checks the gradient of the compiled graph against finite differences
+func TestCompiledGradient(t *testing.T) {
+	hiddenSize := 4
+	back := testBackends(5, 5, hiddenSize)
+	back.Wy = G.Gaussian32(0, 1, 5, hiddenSize)
+	back.Wi = G.Gaussian32(0, 1, hiddenSize, 5)
+	back.Wc = G.Gaussian32(0, 1, hiddenSize, 5)
+	back.Wo = G.Gaussian32(0, 1, hiddenSize, 5)
+	costOf := func(b *backends, solver G.Solver) (*Model, float32) {
+		m := newModelFromBackends(b)
+		hiddenT := tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(hiddenSize))
+		cellT := tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(hiddenSize))
+		cost, _, err := m.trainStep(indexSet{newTestSet()}, solver, newGraphCache(), hiddenT, cellT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m, cost
+	}
+	// with a learn rate of 1, the vanilla solver subtracts the gradient
+	trained, cost := costOf(cloneBackends(back), G.NewVanillaSolver(G.WithLearnRate(1)))
+	eps := float32(1e-2)
+	for i := range back.Wy {
+		shifted := cloneBackends(back)
+		shifted.Wy[i] += eps
+		_, shiftedCost := costOf(shifted, G.NewVanillaSolver(G.WithLearnRate(0)))
+		grad := back.Wy[i] - trained.wy[i]
+		numGrad := (shiftedCost - cost) / eps
+		if math.Abs(float64(grad-numGrad)) > 5e-3 {
+			t.Fatalf("gradient of Wy[%v] is %v, finite differences give %v", i, grad, numGrad)
+		}
+	}
+}
+
+// TestIgnoredPositions checks the positions expecting datasetter.Ignore are skipped by both graphs
+func TestIgnoredPositions(t *testing.T) {
+	hiddenSize := 4
+	back := testBackends(5, 5, hiddenSize)
+	back.Wy = G.Gaussian32(0, 1, 5, hiddenSize)
+	costOf := func(set datasetter.Trainer) float32 {
+		m := newModelFromBackends(cloneBackends(back))
+		hiddenT := tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(hiddenSize))
+		cellT := tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(hiddenSize))
+		cost, _, err := m.trainStep(set, G.NewVanillaSolver(G.WithLearnRate(0)), newGraphCache(), hiddenT, cellT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cost
+	}
+	ignored := func() *testSet {
+		set := newTestSet()
+		set.expectedValues[0] = datasetter.Ignore
+		set.expectedValues[1] = datasetter.Ignore
+		return set
+	}
+	full := costOf(newTestSet())
+	rebuilt := costOf(ignored())
+	compiled := costOf(indexSet{ignored()})
+	if math.Abs(float64(rebuilt-compiled)) > 1e-4 {
+		t.Fatalf("the costs differ: %v/%v", rebuilt, compiled)
+	}
+	// the costs are the means of the loss of the 3 learned tokens and of the 5 tokens of the full set
+	if 3*rebuilt >= 5*full {
+		t.Fatalf("the ignored positions should not add to the cost: %v/%v", 3*rebuilt, 5*full)
+	}
+}
+
+// TestTrainBatch checks the cost of a batch is the mean of the loss of its tokens and
+// that a padded row does not change the cost nor the gradient
+func TestTrainBatch(t *testing.T) {
+	hiddenSize := 4
+	back := testBackends(5, 5, hiddenSize)
+	back.Wy = G.Gaussian32(0, 1, 5, hiddenSize)
+	back.Wi = G.Gaussian32(0, 1, hiddenSize, 5)
+	newMemory := func(rows int) (tensor.Tensor, tensor.Tensor) {
+		return tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(rows, hiddenSize)),
+			tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(rows, hiddenSize))
+	}
+	run := func(batch *datasetter.Batch, learnRate float32) (*Model, float32) {
+		m := newModelFromBackends(cloneBackends(back))
+		hiddenT, cellT := newMemory(batch.Inputs.Shape()[0])
+		cost, _, err := m.trainBatch(batch, G.NewVanillaSolver(G.WithLearnRate(float64(learnRate))), newGraphCache(), hiddenT, cellT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m, cost
+	}
+	first := []int{0, 1, 2, 3}
+	firstTargets := []int{1, 2, 3, 4}
+	second := []int{4, 3, 2, 1}
+	secondTargets := []int{3, 2, 1, 0}
+	ones := []float32{1, 1, 1, 1}
+	cat := func(a, b []int) []int {
+		return append(append([]int(nil), a...), b...)
+	}
+
+	_, firstCost := run(datasetter.NewBatch(1, 4, first, firstTargets, ones), 0)
+	_, secondCost := run(datasetter.NewBatch(1, 4, second, secondTargets, ones), 0)
+	_, cost := run(datasetter.NewBatch(2, 4, cat(first, second), cat(firstTargets, secondTargets), append(append([]float32(nil), ones...), ones...)), 0)
+	if math.Abs(float64(cost-(firstCost+secondCost)/2)) > 1e-5 {
+		t.Fatalf("the cost of the batch is %v, the mean of the costs is %v", cost, (firstCost+secondCost)/2)
+	}
+
+	mask := []float32{1, 1, 1, 1, 0, 0, 0, 0}
+	single, singleCost := run(datasetter.NewBatch(1, 4, first, firstTargets, ones), 1)
+	padded, paddedCost := run(datasetter.NewBatch(2, 4, cat(first, second), cat(firstTargets, secondTargets), mask), 1)
+	if math.Abs(float64(singleCost-paddedCost)) > 1e-5 {
+		t.Fatalf("the padded row changed the cost: %v/%v", singleCost, paddedCost)
+	}
+	for i := range single.wy {
+		if math.Abs(float64(single.wy[i]-padded.wy[i])) > 1e-5 {
+			t.Fatalf("the padded row changed the gradient: %v/%v", single.wy[i], padded.wy[i])
+		}
+	}
+}
+
+func benchmarkTrainStep(b *testing.B, compiled bool) {
+	hiddenSize := 100
+	size := 50
+	model := NewModel(size, size, hiddenSize)
+	solver := G.NewRMSPropSolver(G.WithLearnRate(1e-3), G.WithL2Reg(1e-6), G.WithClip(5))
+	hiddenT := tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(hiddenSize))
+	cellT := tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(hiddenSize))
+	values := make([][]float32, 30)
+	expected := make([]int, 30)
+	for i := range values {
+		values[i] = make([]float32, size)
+		values[i][i%size] = 1
+		expected[i] = (i + 1) % size
+	}
+	graphs := newGraphCache()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var tset = &testSet{values: values, expectedValues: expected}
+		var err error
+		if compiled {
+			_, _, err = model.trainStep(indexSet{tset}, solver, graphs, hiddenT, cellT)
+		} else {
+			_, _, err = model.trainStep(tset, solver, graphs, hiddenT, cellT)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTrainStepRebuilt(b *testing.B) {
+	benchmarkTrainStep(b, false)
+}
+
+func BenchmarkTrainStepCompiled(b *testing.B) {
+	benchmarkTrainStep(b, true)
+}
@@ -1,11 +1,14 @@
 package char
 
 import (
-	"io"
-	// "fmt"
 	"bytes"
+	"io"
+	"math"
 )
 
+// EndOfSequence is the token that ends a generation
+const EndOfSequence = "<eos>"
+
 // Prediction is the based type that can be used as a training dataset
 type Prediction struct {
 	input      *bytes.Buffer
@@ -14,17 +17,63 @@ type Prediction struct {
 	generated  int
 	vocabSize  int
 	output     [][]float32
+	// stop holds the indices of the tokens ending the generation
+	stop map[int]bool
+	last int
+	done bool
+
+	sampler Sampler
+	history []int
+
+	scores []TokenScore
+	// logLikelihood and sampled include the token ending the generation
+	logLikelihood float64
+	sampled       int
 }
 
-// NewPrediction return an object suitable for the LSTM
-func NewPrediction(input string, runeToIdx func(r string) (int, error), sampleSize, vocabSize int) *Prediction {
-	return &Prediction{
+// TokenScore tells how confident the model was when a token was generated
+type TokenScore struct {
+	// Index of the token in the vocabulary
+	Index int
+	// Probability given by the model to the token
+	Probability float32
+	// Entropy (in nats) of the distribution the token was sampled from
+	Entropy float64
+}
+
+// PredictionOpt is a construction option of a Prediction
+type PredictionOpt func(p *Prediction)
+
+// WithSampler sets the Sampler choosing the generated tokens. The default is a GreedySampler
+func WithSampler(s Sampler) PredictionOpt {
+	return func(p *Prediction) {
+		p.sampler = s
+	}
+}
+
+// NewPrediction return an object suitable for the LSTM.
+// Once the input is consumed, at most sampleSize tokens are generated; the generation
+// stops earlier if a newline or an EndOfSequence token is predicted
+func NewPrediction(input string, runeToIdx func(r string) (int, error), sampleSize, vocabSize int, opts ...PredictionOpt) *Prediction {
+	stop := make(map[int]bool)
+	for _, tk := range []string{"\n", EndOfSequence} {
+		if idx, err := runeToIdx(tk); err == nil {
+			stop[idx] = true
+		}
+	}
+	p := &Prediction{
 		input:      bytes.NewBufferString(input),
 		runeToIdx:  runeToIdx,
 		sampleSize: sampleSize,
 		vocabSize:  vocabSize,
 		output:     make([][]float32, 0),
+		stop:       stop,
+		sampler:    NewGreedySampler(),
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // Float32Read ...
@@ -42,22 +91,71 @@ func (p *Prediction) Read(tk string) ([]float32, error) {
 	return backend, nil
 }
 
-// Float32Write ...
+// Float32Write samples the next token from the distribution val
 func (p *Prediction) Write(val []float32) error {
-	max := float32(0)
-	idx := 0
-	for i := range val {
-		if val[i] >= max {
-			max = val[i]
-			idx = i
-		}
+	idx := p.sampler.Sample(val, p.history)
+	score := TokenScore{
+		Index:       idx,
+		Probability: val[idx],
+		Entropy:     entropy(val),
+	}
+	p.logLikelihood += math.Log(float64(score.Probability))
+	p.sampled++
+	if p.stop[idx] {
+		p.done = true
+		return nil
 	}
 	output := make([]float32, len(val))
 	output[idx] = 1
 	p.output = append(p.output, output)
+	p.last = idx
+	p.history = append(p.history, idx)
+	p.scores = append(p.scores, score)
+	p.generated++
 	return nil
 }
 
+// Next returns the one-hot encoding of the last generated token so it can be used as the next input.
+// It returns io.EOF once a stop token has been generated or sampleSize tokens have been generated
+func (p *Prediction) Next() ([]float32, error) {
+	if p.done || len(p.output) == 0 || p.generated >= p.sampleSize {
+		return nil, io.EOF
+	}
+	backend := make([]float32, p.vocabSize)
+	backend[p.last] = 1
+	return backend, nil
+}
+
+// GetScores returns the score of every generated token, in order
+func (p *Prediction) GetScores() []TokenScore {
+	return p.scores
+}
+
+// LogLikelihood returns the log-probability of the generated sequence,
+// including the token that ended the generation
+func (p *Prediction) LogLikelihood() float64 {
+	return p.logLikelihood
+}
+
+// Confidence returns the geometric mean of the probabilities of the sampled tokens (in [0,1]).
+// It is 0 if nothing was sampled
+func (p *Prediction) Confidence() float64 {
+	if p.sampled == 0 {
+		return 0
+	}
+	return math.Exp(p.logLikelihood / float64(p.sampled))
+}
+
+func entropy(probs []float32) float64 {
+	var h float64
+	for _, p := range probs {
+		if p > 0 {
+			h -= float64(p) * math.Log(float64(p))
+		}
+	}
+	return h
+}
+
 // GetOutput ...
 func (p *Prediction) GetOutput() [][]float32 {
 	return p.output
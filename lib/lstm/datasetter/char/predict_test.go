@@ -0,0 +1,52 @@
+package char
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestPredictionScores(t *testing.T) {
+	tokens := []string{"\n", "a", "b"}
+	runeToIdx := func(tk string) (int, error) {
+		for i, t := range tokens {
+			if t == tk {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("unknown token %v", tk)
+	}
+	p := NewPrediction("a", runeToIdx, 10, len(tokens))
+	for _, val := range [][]float32{
+		{0.1, 0.5, 0.4},
+		{0.2, 0.2, 0.6},
+		{0.8, 0.1, 0.1},
+	} {
+		if err := p.Write(val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := p.Next(); err != io.EOF {
+		t.Fatal("the generation should be over after a newline")
+	}
+	scores := p.GetScores()
+	if len(scores) != 2 || scores[0].Index != 1 || scores[1].Index != 2 {
+		t.Fatalf("bad scores %v", scores)
+	}
+	if scores[0].Probability != 0.5 || scores[1].Probability != 0.6 {
+		t.Fatalf("bad probabilities %v", scores)
+	}
+	uniform := NewPrediction("a", runeToIdx, 10, len(tokens))
+	uniform.Write([]float32{0, 0.5, 0.5})
+	if h := uniform.GetScores()[0].Entropy; math.Abs(h-math.Log(2)) > 1e-6 {
+		t.Fatalf("expected an entropy of log(2), got %v", h)
+	}
+	logLikelihood := math.Log(float64(float32(0.5))) + math.Log(float64(float32(0.6))) + math.Log(float64(float32(0.8)))
+	if math.Abs(p.LogLikelihood()-logLikelihood) > 1e-9 {
+		t.Fatalf("expected a log-likelihood of %v, got %v", logLikelihood, p.LogLikelihood())
+	}
+	if c := p.Confidence(); math.Abs(c-math.Exp(logLikelihood/3)) > 1e-9 {
+		t.Fatalf("bad confidence %v", c)
+	}
+}
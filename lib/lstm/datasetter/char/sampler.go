@@ -0,0 +1,229 @@
+package char
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Sampler picks the index of the next token from the probability distribution computed by the model.
+// history holds the indices generated so far
+type Sampler interface {
+	Sample(probs []float32, history []int) int
+}
+
+// NewRand returns a source of randomness for the samplers.
+// A seed of zero uses the current time
+func NewRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// GreedySampler always picks the most probable token.
+// On ties, the lowest index wins
+type GreedySampler struct{}
+
+// NewGreedySampler ...
+func NewGreedySampler() *GreedySampler {
+	return &GreedySampler{}
+}
+
+// Sample returns the argmax of probs
+func (GreedySampler) Sample(probs []float32, history []int) int {
+	return argmax(probs)
+}
+
+// TemperatureSampler draws a token from the distribution sharpened (temperature < 1)
+// or flattened (temperature > 1) by the temperature
+type TemperatureSampler struct {
+	temperature float64
+	rand        *rand.Rand
+}
+
+// NewTemperatureSampler ...
+func NewTemperatureSampler(temperature float64, rnd *rand.Rand) *TemperatureSampler {
+	if rnd == nil {
+		rnd = NewRand(0)
+	}
+	return &TemperatureSampler{
+		temperature: temperature,
+		rand:        rnd,
+	}
+}
+
+// Sample ...
+func (s *TemperatureSampler) Sample(probs []float32, history []int) int {
+	if s.temperature <= 0 {
+		return argmax(probs)
+	}
+	return draw(s.rand, withTemperature(probs, s.temperature), allIndices(len(probs)))
+}
+
+// TopKSampler draws a token among the k most probable ones
+type TopKSampler struct {
+	k           int
+	temperature float64
+	rand        *rand.Rand
+}
+
+// NewTopKSampler ...
+func NewTopKSampler(k int, temperature float64, rnd *rand.Rand) *TopKSampler {
+	if rnd == nil {
+		rnd = NewRand(0)
+	}
+	return &TopKSampler{
+		k:           k,
+		temperature: temperature,
+		rand:        rnd,
+	}
+}
+
+// Sample ...
+func (s *TopKSampler) Sample(probs []float32, history []int) int {
+	if s.temperature <= 0 || s.k == 1 {
+		return argmax(probs)
+	}
+	weights := withTemperature(probs, s.temperature)
+	candidates := sortedIndices(weights)
+	if s.k > 0 && s.k < len(candidates) {
+		candidates = candidates[:s.k]
+	}
+	return draw(s.rand, weights, candidates)
+}
+
+// TopPSampler (nucleus sampling) draws a token among the smallest set of most probable
+// tokens whose cumulative probability reaches p
+type TopPSampler struct {
+	p           float64
+	temperature float64
+	rand        *rand.Rand
+}
+
+// NewTopPSampler ...
+func NewTopPSampler(p, temperature float64, rnd *rand.Rand) *TopPSampler {
+	if rnd == nil {
+		rnd = NewRand(0)
+	}
+	return &TopPSampler{
+		p:           p,
+		temperature: temperature,
+		rand:        rnd,
+	}
+}
+
+// Sample ...
+func (s *TopPSampler) Sample(probs []float32, history []int) int {
+	if s.temperature <= 0 {
+		return argmax(probs)
+	}
+	weights := withTemperature(probs, s.temperature)
+	candidates := sortedIndices(weights)
+	var total, cumulative float64
+	for _, w := range weights {
+		total += w
+	}
+	for i, idx := range candidates {
+		cumulative += weights[idx]
+		if cumulative >= s.p*total {
+			candidates = candidates[:i+1]
+			break
+		}
+	}
+	return draw(s.rand, weights, candidates)
+}
+
+// RepetitionPenalty divides the probability of the tokens already generated by penalty
+// before handing the distribution to the underlying Sampler
+type RepetitionPenalty struct {
+	penalty float64
+	sampler Sampler
+}
+
+// NewRepetitionPenalty ...
+func NewRepetitionPenalty(penalty float64, s Sampler) *RepetitionPenalty {
+	return &RepetitionPenalty{
+		penalty: penalty,
+		sampler: s,
+	}
+}
+
+// Sample ...
+func (r *RepetitionPenalty) Sample(probs []float32, history []int) int {
+	if r.penalty == 1 || len(history) == 0 {
+		return r.sampler.Sample(probs, history)
+	}
+	penalized := make([]float32, len(probs))
+	copy(penalized, probs)
+	seen := make(map[int]bool, len(history))
+	for _, idx := range history {
+		if seen[idx] || idx < 0 || idx >= len(penalized) {
+			continue
+		}
+		seen[idx] = true
+		penalized[idx] = float32(float64(penalized[idx]) / r.penalty)
+	}
+	return r.sampler.Sample(penalized, history)
+}
+
+func argmax(probs []float32) int {
+	idx := 0
+	for i := range probs {
+		if probs[i] > probs[idx] {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// withTemperature returns the unnormalized weights (p/max)^(1/temperature).
+// Dividing by the highest probability keeps its weight at 1, so a low temperature
+// cannot underflow every weight to zero
+func withTemperature(probs []float32, temperature float64) []float64 {
+	weights := make([]float64, len(probs))
+	maxLog := math.Log(float64(probs[argmax(probs)]))
+	for i, p := range probs {
+		if p > 0 {
+			weights[i] = math.Exp((math.Log(float64(p)) - maxLog) / temperature)
+		}
+	}
+	return weights
+}
+
+func allIndices(n int) []int {
+	indices := make([]int, n)
+	for i := range indices {
+		indices[i] = i
+	}
+	return indices
+}
+
+// sortedIndices returns the indices of weights from the highest to the lowest weight
+func sortedIndices(weights []float64) []int {
+	indices := allIndices(len(weights))
+	sort.SliceStable(indices, func(i, j int) bool {
+		return weights[indices[i]] > weights[indices[j]]
+	})
+	return indices
+}
+
+// draw picks one of the candidates with a probability proportional to its weight
+func draw(rnd *rand.Rand, weights []float64, candidates []int) int {
+	var total float64
+	for _, idx := range candidates {
+		total += weights[idx]
+	}
+	if total <= 0 {
+		return candidates[0]
+	}
+	threshold := rnd.Float64() * total
+	for _, idx := range candidates {
+		threshold -= weights[idx]
+		if threshold < 0 {
+			return idx
+		}
+	}
+	return candidates[len(candidates)-1]
+}
@@ -0,0 +1,85 @@
+package char
+
+import "testing"
+
+func TestGreedySampler(t *testing.T) {
+	s := NewGreedySampler()
+	if idx := s.Sample([]float32{0.1, 0.4, 0.4, 0.1}, nil); idx != 1 {
+		t.Fatalf("ties should go to the first index, got %v", idx)
+	}
+}
+
+func TestSamplersAreSeedable(t *testing.T) {
+	probs := []float32{0.1, 0.2, 0.3, 0.25, 0.15}
+	samplers := map[string]func(seed int64) Sampler{
+		"temperature": func(seed int64) Sampler { return NewTemperatureSampler(1.2, NewRand(seed)) },
+		"topk":        func(seed int64) Sampler { return NewTopKSampler(3, 1, NewRand(seed)) },
+		"topp":        func(seed int64) Sampler { return NewTopPSampler(0.9, 1, NewRand(seed)) },
+	}
+	for name, newSampler := range samplers {
+		a, b := newSampler(42), newSampler(42)
+		for i := 0; i < 100; i++ {
+			if x, y := a.Sample(probs, nil), b.Sample(probs, nil); x != y {
+				t.Fatalf("%v: same seed gave different samples (%v, %v)", name, x, y)
+			}
+		}
+	}
+}
+
+func TestTopKSampler(t *testing.T) {
+	s := NewTopKSampler(2, 1, NewRand(1))
+	probs := []float32{0.1, 0.3, 0.05, 0.35, 0.2}
+	for i := 0; i < 1000; i++ {
+		if idx := s.Sample(probs, nil); idx != 1 && idx != 3 {
+			t.Fatalf("%v is not part of the top 2", idx)
+		}
+	}
+}
+
+func TestTopPSampler(t *testing.T) {
+	s := NewTopPSampler(0.6, 1, NewRand(1))
+	probs := []float32{0.1, 0.3, 0.05, 0.35, 0.2}
+	for i := 0; i < 1000; i++ {
+		if idx := s.Sample(probs, nil); idx != 1 && idx != 3 {
+			t.Fatalf("%v is not part of the nucleus", idx)
+		}
+	}
+}
+
+func TestTemperatureSampler(t *testing.T) {
+	s := NewTemperatureSampler(0.01, NewRand(1))
+	probs := []float32{0.2, 0.25, 0.3, 0.25}
+	for i := 0; i < 100; i++ {
+		if idx := s.Sample(probs, nil); idx != 2 {
+			t.Fatalf("a very low temperature should behave like greedy, got %v", idx)
+		}
+	}
+}
+
+func TestLowTemperature(t *testing.T) {
+	// p^(1/T) underflows for every token at such a temperature
+	probs := []float32{0.05, 0.1, 0.6, 0.25}
+	samplers := map[string]Sampler{
+		"temperature": NewTemperatureSampler(1e-4, NewRand(1)),
+		"topk":        NewTopKSampler(3, 1e-4, NewRand(1)),
+		"topp":        NewTopPSampler(0.9, 1e-4, NewRand(1)),
+	}
+	for name, s := range samplers {
+		for i := 0; i < 100; i++ {
+			if idx := s.Sample(probs, nil); idx != 2 {
+				t.Fatalf("%v: a temperature close to zero should pick the greedy token, got %v", name, idx)
+			}
+		}
+	}
+}
+
+func TestRepetitionPenalty(t *testing.T) {
+	s := NewRepetitionPenalty(2, NewGreedySampler())
+	probs := []float32{0.1, 0.5, 0.4}
+	if idx := s.Sample(probs, nil); idx != 1 {
+		t.Fatalf("without history, expected 1, got %v", idx)
+	}
+	if idx := s.Sample(probs, []int{1, 1}); idx != 2 {
+		t.Fatalf("the repeated token should be penalized, got %v", idx)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
+	"sort"
 	"strings"
 	// "errors"
 
@@ -25,6 +27,46 @@ type TrainingSet struct {
 	vocabSize int
 	step      int
 	pass      int
+
+	// pairs holds the [start, end) offsets of the blank line separated pairs of bufVocab
+	pairs [][2]int
+	// samples holds the [start, end) offsets of the sections in bufVocab and
+	// order the indices of the samples for the current epoch
+	samples [][2]int
+	order   []int
+	epoch   int
+
+	alignPairs bool
+	shuffle    bool
+	seed       int64
+	bucket     bool
+}
+
+// TrainingSetOpt is a construction option of a TrainingSet
+type TrainingSetOpt func(t *TrainingSet)
+
+// WithPairs aligns the sections on the pairs of the corpus: a section never crosses
+// the blank line separating two pairs. A pair shorter than the window is a single section
+func WithPairs() TrainingSetOpt {
+	return func(t *TrainingSet) {
+		t.alignPairs = true
+	}
+}
+
+// WithShuffle shuffles the sections at every epoch. The order of an epoch only depends on seed and the epoch
+func WithShuffle(seed int64) TrainingSetOpt {
+	return func(t *TrainingSet) {
+		t.shuffle = true
+		t.seed = seed
+	}
+}
+
+// WithBucketing groups the sections of similar lengths in the same batches to reduce the padding.
+// The order of the batches is still shuffled if WithShuffle is set
+func WithBucketing() TrainingSetOpt {
+	return func(t *TrainingSet) {
+		t.bucket = true
+	}
 }
 
 // Section ...
@@ -35,51 +77,187 @@ type Section struct {
 	offset    int
 }
 
-// NewTrainingSet from a ReadSeeker
-func NewTrainingSet(rs io.ReadSeeker, runeToIdx func(r string) (int, error), idxToRune func(r int) (string, error), vocabSize, batchsize, step int) *TrainingSet {
+// NewTrainingSet from a ReadSeeker.
+// The sections are windows of batchsize tokens sliding by step tokens
+func NewTrainingSet(rs io.ReadSeeker, runeToIdx func(r string) (int, error), idxToRune func(r int) (string, error), vocabSize, batchsize, step int, opts ...TrainingSetOpt) *TrainingSet {
 	if batchsize < step {
 		log.Fatal("batchSize cannot be less than the step")
 	}
 
-	bufVocab := make([]int, 0) 
+	bufVocab := make([]int, 0)
 	buf := bufio.NewReader(rs)
 	end := false
 
 	newLineVocab, _ := runeToIdx("\n")
 
-	for i:=0; !end; i++ {
-	    l, err := buf.ReadString('\n')
-	    if err != nil {
-		end = true
-	    }
+	for i := 0; !end; i++ {
+		l, err := buf.ReadString('\n')
+		if err != nil {
+			end = true
+		}
+
+		if l == "\n" {
+			bufVocab = append(bufVocab, newLineVocab)
+		}
 
-	    if l == "\n" {
-		bufVocab = append(bufVocab, newLineVocab)
-	    }
+		l = strings.TrimRight(l, "\n")
 
-	    l = strings.TrimRight(l, "\n")
+		parts := strings.Fields(l)
+		for _, p := range parts {
 
-	    parts := strings.Fields(l)
-	    for _, p := range parts {
-	    
-		idx, err := runeToIdx(p)
-		if err != nil {
-		    return nil
-		}
+			idx, err := runeToIdx(p)
+			if err != nil {
+				return nil
+			}
 
-		bufVocab = append(bufVocab, idx)
-	    }
+			bufVocab = append(bufVocab, idx)
+		}
 	}
 
-	return &TrainingSet{
+	t := &TrainingSet{
 		bufOffset: 0,
-		bufVocab: bufVocab,
+		bufVocab:  bufVocab,
 		batchSize: batchsize,
 		vocabSize: vocabSize,
 		step:      step,
 		runeToIdx: runeToIdx,
 		idxToRune: idxToRune,
+		pairs:     splitPairs(bufVocab, newLineVocab),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.samples = t.windows()
+	return t
+}
+
+// splitPairs returns the offsets of the pairs of vocab. A pair ends with the newline
+// token of the blank line following it
+func splitPairs(vocab []int, newLine int) [][2]int {
+	var pairs [][2]int
+	start := 0
+	for i, idx := range vocab {
+		if idx != newLine {
+			continue
+		}
+		pairs = append(pairs, [2]int{start, i + 1})
+		start = i + 1
+	}
+	if start < len(vocab) {
+		pairs = append(pairs, [2]int{start, len(vocab)})
+	}
+	return pairs
+}
+
+// windows returns the offsets of the sections
+func (t *TrainingSet) windows() [][2]int {
+	if !t.alignPairs {
+		return slide(0, len(t.bufVocab), t.batchSize, t.step)
+	}
+	var samples [][2]int
+	for _, pair := range t.pairs {
+		// a section needs at least an input and an expected value
+		if pair[1]-pair[0] < 2 {
+			continue
+		}
+		if pair[1]-pair[0] <= t.batchSize {
+			samples = append(samples, pair)
+			continue
+		}
+		windows := slide(pair[0], pair[1], t.batchSize, t.step)
+		// the end of the pair is always read
+		if last := windows[len(windows)-1]; last[1] < pair[1] {
+			windows = append(windows, [2]int{pair[1] - t.batchSize, pair[1]})
+		}
+		samples = append(samples, windows...)
+	}
+	return samples
+}
+
+// slide returns the windows of size tokens starting every step tokens in [start, end)
+func slide(start, end, size, step int) [][2]int {
+	if step <= 0 {
+		step = 1
+	}
+	var windows [][2]int
+	for i := start; i+size <= end; i += step {
+		windows = append(windows, [2]int{i, i + size})
+	}
+	return windows
+}
+
+// newEpoch computes the order of the sections of the current epoch.
+// rows is the number of sections of a batch, it is used to bucket the sections
+func (t *TrainingSet) newEpoch(rows int) {
+	t.order = make([]int, len(t.samples))
+	for i := range t.order {
+		t.order[i] = i
+	}
+	var rnd *rand.Rand
+	if t.shuffle {
+		rnd = rand.New(rand.NewSource(t.seed + int64(t.epoch)))
+		rnd.Shuffle(len(t.order), func(i, j int) {
+			t.order[i], t.order[j] = t.order[j], t.order[i]
+		})
 	}
+	if !t.bucket || rows <= 1 {
+		return
+	}
+	length := func(i int) int {
+		return t.samples[i][1] - t.samples[i][0]
+	}
+	sort.SliceStable(t.order, func(i, j int) bool {
+		return length(t.order[i]) < length(t.order[j])
+	})
+	if rnd == nil {
+		return
+	}
+	// shuffle the batches, not the sections inside a batch
+	batches := make([][]int, 0, len(t.order)/rows+1)
+	for i := 0; i < len(t.order); i += rows {
+		end := i + rows
+		if end > len(t.order) {
+			end = len(t.order)
+		}
+		batches = append(batches, t.order[i:end])
+	}
+	rnd.Shuffle(len(batches), func(i, j int) {
+		batches[i], batches[j] = batches[j], batches[i]
+	})
+	order := make([]int, 0, len(t.order))
+	for _, b := range batches {
+		order = append(order, b...)
+	}
+	t.order = order
+}
+
+// Rewind starts a new epoch: the next section is the first one of the new order
+func (t *TrainingSet) Rewind() {
+	t.epoch++
+	t.bufOffset = 0
+	t.order = nil
+}
+
+// Epoch returns the number of times the TrainingSet has been rewound
+func (t *TrainingSet) Epoch() int {
+	return t.epoch
+}
+
+// Position returns the number of sections already read in the current epoch and the number of sections of an epoch
+func (t *TrainingSet) Position() (int, int) {
+	return t.bufOffset, len(t.samples)
+}
+
+// Seek moves to the given position of an epoch, as returned by Epoch and Position,
+// so a training can be resumed where it stopped
+func (t *TrainingSet) Seek(epoch, offset int) error {
+	if epoch < 0 || offset < 0 || offset > len(t.samples) {
+		return fmt.Errorf("cannot seek to the sections %v of the epoch %v, an epoch holds %v sections", offset, epoch, len(t.samples))
+	}
+	t.epoch = epoch
+	t.bufOffset = offset
+	t.order = nil
+	return nil
 }
 
 // ReadInputVector returns the input vector until it reach the penultimate rune
@@ -115,35 +293,74 @@ func (s *Section) GetExpectedValue(offset int) (int, error) {
 	return s.sentence[offset+1], nil
 }
 
-// GetTrainer returns a pointer so a Section. It reads batchSize runes
-// and add it to the returned section.
-// The offset of the underlying io.ReadSeeker is set to the position it had
-// when entering the function + step * runes * rune_size
-// Any error in reading is returned
+// Len returns the number of input vectors of the section
+func (s *Section) Len() int {
+	return len(s.sentence) - 1
+}
+
+// GetInputValue returns the encoded value of the rune present at offset
+func (s *Section) GetInputValue(offset int) (int, error) {
+	return s.sentence[offset], nil
+}
+
+// GetTrainer returns a pointer so a Section. It reads the next window of batchSize tokens
+// of the epoch and returns io.EOF once every window has been read
 func (t *TrainingSet) GetTrainer() (datasetter.Trainer, error) {
-	// if we are not at the begining of the file,
-	// we have done already a pass, then move the cursor
-	// This is done at the begining of the file so whatever error could be return
-	// If it was done at the end of the pass, any error would lead to
-	// be interpreted by the caller of the func as "unable to provide a Section"
-	// and the corresponding section would be discarded
+	return t.next(1)
+}
 
+// next returns the next section of the epoch, rows is the number of sections read per batch
+func (t *TrainingSet) next(rows int) (*Section, error) {
+	if t.order == nil {
+		t.newEpoch(rows)
+	}
+	if t.bufOffset >= len(t.order) {
+		return nil, io.EOF
+	}
+	sample := t.samples[t.order[t.bufOffset]]
 	section := &Section{
 		vocabSize: t.vocabSize,
 		offset:    0,
-		sentence:  make([]int, t.batchSize),
-	}
-	// Peek as many bytes as needed for peeking as many tokens needed
-
-	for i := 0; i < t.batchSize; i++ {
-	    if len(t.bufVocab) <= t.bufOffset + i {
-		return nil, io.EOF
-	    }
-	    section.sentence[i] = t.bufVocab[t.bufOffset + i]
+		sentence:  make([]int, sample[1]-sample[0]),
 	}
-
+	copy(section.sentence, t.bufVocab[sample[0]:sample[1]])
 	t.bufOffset++
-
 	t.pass++
 	return section, nil
 }
+
+// GetBatch returns the next size sections of the epoch, one per row of the batch.
+// The rows are as long as the longest section; the shorter rows and the missing rows
+// at the end of an epoch are padded and masked.
+// io.EOF is returned when no section is left
+func (t *TrainingSet) GetBatch(size int) (*datasetter.Batch, error) {
+	sections := make([]*Section, 0, size)
+	seqLen := 0
+	for len(sections) < size {
+		section, err := t.next(size)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, section)
+		if section.Len() > seqLen {
+			seqLen = section.Len()
+		}
+	}
+	if len(sections) == 0 {
+		return nil, io.EOF
+	}
+	inputs := make([]int, size*seqLen)
+	targets := make([]int, size*seqLen)
+	mask := make([]float32, size*seqLen)
+	for row, section := range sections {
+		for i := 0; i < section.Len(); i++ {
+			inputs[row*seqLen+i] = section.sentence[i]
+			targets[row*seqLen+i] = section.sentence[i+1]
+			mask[row*seqLen+i] = 1
+		}
+	}
+	return datasetter.NewBatch(size, seqLen, inputs, targets, mask), nil
+}
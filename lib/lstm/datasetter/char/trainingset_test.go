@@ -1 +1,147 @@
 package char
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testTokens = []string{"\n", "a", "b", "c", "d", "e", "f"}
+
+func newTestTrainingSet(corpus string, window, stride int, opts ...TrainingSetOpt) *TrainingSet {
+	runeToIdx := func(tk string) (int, error) {
+		for i, t := range testTokens {
+			if t == tk {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("unknown token %v", tk)
+	}
+	idxToRune := func(i int) (string, error) {
+		return testTokens[i], nil
+	}
+	return NewTrainingSet(strings.NewReader(corpus), runeToIdx, idxToRune, len(testTokens), window, stride, opts...)
+}
+
+// readAll returns the sentences of the sections of an epoch
+func readAll(t *testing.T, tset *TrainingSet) [][]int {
+	var sentences [][]int
+	for {
+		trainer, err := tset.GetTrainer()
+		if err == io.EOF {
+			return sentences
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		sentences = append(sentences, trainer.(*Section).sentence)
+	}
+}
+
+func TestTrainingSetStride(t *testing.T) {
+	tset := newTestTrainingSet("a b c d e f", 3, 2)
+	expected := [][]int{{1, 2, 3}, {3, 4, 5}}
+	if sentences := readAll(t, tset); !reflect.DeepEqual(sentences, expected) {
+		t.Fatalf("expected %v, got %v", expected, sentences)
+	}
+}
+
+func TestTrainingSetPairs(t *testing.T) {
+	corpus := "a b\nc\n\nd e\nf\n\na\nb c d e\n"
+	// without alignment, the second window crosses the blank line
+	if sentences := readAll(t, newTestTrainingSet(corpus, 4, 2)); !reflect.DeepEqual(sentences[1], []int{3, 0, 4, 5}) {
+		t.Fatalf("unexpected window %v", sentences[1])
+	}
+	expected := [][]int{
+		{1, 2, 3, 0},
+		{4, 5, 6, 0},
+		// the last pair is longer than the window
+		{1, 2, 3, 4},
+		{2, 3, 4, 5},
+	}
+	if sentences := readAll(t, newTestTrainingSet(corpus, 4, 2, WithPairs())); !reflect.DeepEqual(sentences, expected) {
+		t.Fatalf("expected %v, got %v", expected, sentences)
+	}
+}
+
+func TestTrainingSetShuffle(t *testing.T) {
+	corpus := "a b c d e f a b c d e f"
+	epochs := func(seed int64) [][][]int {
+		tset := newTestTrainingSet(corpus, 2, 1, WithShuffle(seed))
+		var res [][][]int
+		for i := 0; i < 3; i++ {
+			res = append(res, readAll(t, tset))
+			tset.Rewind()
+		}
+		return res
+	}
+	first, second := epochs(42), epochs(42)
+	if !reflect.DeepEqual(first, second) {
+		t.Fatal("the same seed should give the same orders")
+	}
+	if reflect.DeepEqual(first[0], first[1]) {
+		t.Fatal("every epoch should have its own order")
+	}
+	if len(first[0]) != 11 || len(first[1]) != 11 {
+		t.Fatalf("an epoch should read every window once, got %v", len(first[0]))
+	}
+	if reflect.DeepEqual(first[0], readAll(t, newTestTrainingSet(corpus, 2, 1))) {
+		t.Fatal("the sections are not shuffled")
+	}
+}
+
+func TestTrainingSetBucketing(t *testing.T) {
+	// pairs of 3, 7, 3 and 6 tokens
+	corpus := "a\nb\n\na b c d e\nf\n\nc\nd\n\na b c\ne f\n\n"
+	padding := func(tset *TrainingSet) int {
+		var padding int
+		for {
+			batch, err := tset.GetBatch(2)
+			if err == io.EOF {
+				return padding
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range batch.Mask.Data().([]float32) {
+				if v == 0 {
+					padding++
+				}
+			}
+		}
+	}
+	if p := padding(newTestTrainingSet(corpus, 10, 1, WithPairs())); p != 7 {
+		t.Fatalf("expected 7 padded positions in file order, got %v", p)
+	}
+	// the short pairs and the long pairs are in their own batches
+	if p := padding(newTestTrainingSet(corpus, 10, 1, WithPairs(), WithShuffle(1), WithBucketing())); p != 1 {
+		t.Fatalf("expected 1 padded position, got %v", p)
+	}
+}
+
+func TestGetBatch(t *testing.T) {
+	// 4 tokens and windows of 3 tokens give 2 sections of 2 inputs
+	tset := newTestTrainingSet("a b c d", 3, 1)
+	batch, err := tset.GetBatch(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shape := batch.Inputs.Shape(); shape[0] != 3 || shape[1] != 2 {
+		t.Fatalf("bad shape %v", shape)
+	}
+	if inputs := batch.Inputs.Data().([]int); !reflect.DeepEqual(inputs, []int{1, 2, 2, 3, 0, 0}) {
+		t.Fatalf("bad inputs %v", inputs)
+	}
+	if targets := batch.Targets.Data().([]int); !reflect.DeepEqual(targets, []int{2, 3, 3, 4, 0, 0}) {
+		t.Fatalf("bad targets %v", targets)
+	}
+	// the last row is a padding
+	if mask := batch.Mask.Data().([]float32); !reflect.DeepEqual(mask, []float32{1, 1, 1, 1, 0, 0}) {
+		t.Fatalf("bad mask %v", mask)
+	}
+	if _, err := tset.GetBatch(3); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
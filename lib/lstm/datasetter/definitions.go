@@ -1,6 +1,9 @@
 package datasetter
 
-import G "gorgonia.org/gorgonia"
+import (
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
 
 // ReadWriter is an interface that can Read and returns a oneOfK encoded vector
 type ReadWriter interface {
@@ -9,20 +12,66 @@ type ReadWriter interface {
 	GetComputedVectors() G.Nodes // Should return all the nodes in the correct order
 }
 
+// Ignore is the expected value of a position that does not contribute to the loss
+const Ignore = -1
+
 // Trainer is a particular dataset that can be used to train a rnn
 // it holds expected values
 type Trainer interface {
 	ReadWriter
 	// get the index of the expected output for offset
-	// for example is the expected output is []int{0,0,1,0,0}, it returns 2
+	// for example is the expected output is []int{0,0,1,0,0}, it returns 2.
+	// It returns Ignore if the output at offset must not be learnt
 	GetExpectedValue(offset int) (int, error)
 }
 
+// IndexTrainer is a Trainer that exposes the indices of its inputs
+// so they can be bound to an already compiled graph
+type IndexTrainer interface {
+	Trainer
+	// Len returns the number of input vectors of the sequence
+	Len() int
+	// GetInputValue returns the index of the input at offset
+	GetInputValue(offset int) (int, error)
+}
+
 // FullTrainer object can return subtrainers
 type FullTrainer interface {
 	GetTrainer() (Trainer, error)
 }
 
+// Rewinder is a dataset that can be read again from its start
+type Rewinder interface {
+	// Rewind starts a new epoch
+	Rewind()
+}
+
+// Batch holds B sequences of T tokens
+type Batch struct {
+	// Inputs is a (B × T) tensor of the indices of the input tokens
+	Inputs tensor.Tensor
+	// Targets is a (B × T) tensor of the indices of the expected tokens
+	Targets tensor.Tensor
+	// Mask is a (B × T) tensor of float32 set to 1 for a real token and to 0 for a padding
+	Mask tensor.Tensor
+}
+
+// NewBatch returns a Batch of batchSize sequences of seqLen tokens backed by the slices
+func NewBatch(batchSize, seqLen int, inputs, targets []int, mask []float32) *Batch {
+	return &Batch{
+		Inputs:  tensor.New(tensor.WithShape(batchSize, seqLen), tensor.WithBacking(inputs)),
+		Targets: tensor.New(tensor.WithShape(batchSize, seqLen), tensor.WithBacking(targets)),
+		Mask:    tensor.New(tensor.WithShape(batchSize, seqLen), tensor.WithBacking(mask)),
+	}
+}
+
+// BatchTrainer is a dataset that returns batches of sequences
+type BatchTrainer interface {
+	// GetBatch returns a batch of size sequences; missing sequences are padded.
+	// It returns io.EOF when there is no sequence left
+	GetBatch(size int) (*Batch, error)
+}
+
 // Float32Reader a []float32
 type Float32Reader interface {
 	Read(tk string) ([]float32, error)
@@ -38,3 +87,11 @@ type Float32ReadWriter interface {
 	Float32Reader
 	Float32Writer
 }
+
+// Float32Generator is a Float32ReadWriter that can feed its own output back as an input
+type Float32Generator interface {
+	Float32ReadWriter
+	// Next returns the input vector matching the last written output.
+	// It returns io.EOF when the generation is over
+	Next() ([]float32, error)
+}
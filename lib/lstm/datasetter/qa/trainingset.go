@@ -0,0 +1,275 @@
+// Package qa is a datasetter reading question and answer pairs.
+// A pair is fed as question <sep> answer <eos> and only the answer is learnt
+package qa
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+
+	"github.com/owulveryck/lstm/datasetter"
+	"github.com/owulveryck/lstm/datasetter/char"
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+// Separator is the token between a question and its answer
+const Separator = "<sep>"
+
+// TrainingSet holds the encoded pairs of a corpus where a pair is a question line
+// followed by the lines of its answer, and the pairs are separated by a blank line
+type TrainingSet struct {
+	// pairs holds the encoded question <sep> answer <eos> sequences
+	// and separators the offset of Separator in each of them
+	pairs      [][]int
+	separators []int
+	vocabSize  int
+
+	order   []int
+	offset  int
+	epoch   int
+	shuffle bool
+	seed    int64
+}
+
+// Section is a single pair
+type Section struct {
+	sentence  []int
+	separator int
+	output    G.Nodes
+	vocabSize int
+	offset    int
+}
+
+// TrainingSetOpt is a construction option of a TrainingSet
+type TrainingSetOpt func(t *TrainingSet)
+
+// WithShuffle shuffles the pairs at every epoch. The order of an epoch only depends on seed and the epoch
+func WithShuffle(seed int64) TrainingSetOpt {
+	return func(t *TrainingSet) {
+		t.shuffle = true
+		t.seed = seed
+	}
+}
+
+// NewTrainingSet reads the pairs of r. The vocabulary must hold Separator and char.EndOfSequence
+func NewTrainingSet(r io.Reader, runeToIdx func(r string) (int, error), vocabSize int, opts ...TrainingSetOpt) (*TrainingSet, error) {
+	sep, err := runeToIdx(Separator)
+	if err != nil {
+		return nil, fmt.Errorf("the vocabulary has no separator: %v", err)
+	}
+	eos, err := runeToIdx(char.EndOfSequence)
+	if err != nil {
+		return nil, fmt.Errorf("the vocabulary has no end of sequence: %v", err)
+	}
+	encode := func(line string) ([]int, error) {
+		parts := strings.Fields(line)
+		res := make([]int, len(parts))
+		for i, p := range parts {
+			if res[i], err = runeToIdx(p); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	}
+	t := &TrainingSet{
+		vocabSize: vocabSize,
+	}
+	var lines []string
+	flush := func() error {
+		defer func() {
+			lines = lines[:0]
+		}()
+		if len(lines) < 2 {
+			return nil
+		}
+		question, err := encode(lines[0])
+		if err != nil {
+			return err
+		}
+		answer, err := encode(strings.Join(lines[1:], " "))
+		if err != nil {
+			return err
+		}
+		if len(question) == 0 {
+			return nil
+		}
+		pair := make([]int, 0, len(question)+len(answer)+2)
+		pair = append(pair, question...)
+		pair = append(pair, sep)
+		pair = append(pair, answer...)
+		pair = append(pair, eos)
+		t.pairs = append(t.pairs, pair)
+		t.separators = append(t.separators, len(question))
+		return nil
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			lines = append(lines, line)
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(t.pairs) == 0 {
+		return nil, errors.New("no question and answer pair found")
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t, nil
+}
+
+// Rewind starts a new epoch: the next section is the first pair of the new order
+func (t *TrainingSet) Rewind() {
+	t.epoch++
+	t.offset = 0
+	t.order = nil
+}
+
+// Epoch returns the number of times the TrainingSet has been rewound
+func (t *TrainingSet) Epoch() int {
+	return t.epoch
+}
+
+// Position returns the number of pairs already read in the current epoch and the number of pairs
+func (t *TrainingSet) Position() (int, int) {
+	return t.offset, len(t.pairs)
+}
+
+// Seek moves to the given position of an epoch, as returned by Epoch and Position,
+// so a training can be resumed where it stopped
+func (t *TrainingSet) Seek(epoch, offset int) error {
+	if epoch < 0 || offset < 0 || offset > len(t.pairs) {
+		return fmt.Errorf("cannot seek to the pairs %v of the epoch %v, an epoch holds %v pairs", offset, epoch, len(t.pairs))
+	}
+	t.epoch = epoch
+	t.offset = offset
+	t.order = nil
+	return nil
+}
+
+// GetTrainer returns the next pair of the epoch and io.EOF once every pair has been read
+func (t *TrainingSet) GetTrainer() (datasetter.Trainer, error) {
+	return t.next()
+}
+
+func (t *TrainingSet) next() (*Section, error) {
+	if t.order == nil {
+		t.order = make([]int, len(t.pairs))
+		for i := range t.order {
+			t.order[i] = i
+		}
+		if t.shuffle {
+			rnd := rand.New(rand.NewSource(t.seed + int64(t.epoch)))
+			rnd.Shuffle(len(t.order), func(i, j int) {
+				t.order[i], t.order[j] = t.order[j], t.order[i]
+			})
+		}
+	}
+	if t.offset >= len(t.order) {
+		return nil, io.EOF
+	}
+	i := t.order[t.offset]
+	t.offset++
+	return &Section{
+		sentence:  t.pairs[i],
+		separator: t.separators[i],
+		vocabSize: t.vocabSize,
+	}, nil
+}
+
+// GetBatch returns the next size pairs of the epoch, one per row of the batch.
+// The question positions, the end of the shorter rows and the missing rows are masked.
+// io.EOF is returned when no pair is left
+func (t *TrainingSet) GetBatch(size int) (*datasetter.Batch, error) {
+	sections := make([]*Section, 0, size)
+	seqLen := 0
+	for len(sections) < size {
+		section, err := t.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, section)
+		if section.Len() > seqLen {
+			seqLen = section.Len()
+		}
+	}
+	if len(sections) == 0 {
+		return nil, io.EOF
+	}
+	inputs := make([]int, size*seqLen)
+	targets := make([]int, size*seqLen)
+	mask := make([]float32, size*seqLen)
+	for row, section := range sections {
+		for i := 0; i < section.Len(); i++ {
+			inputs[row*seqLen+i] = section.sentence[i]
+			expected, _ := section.GetExpectedValue(i)
+			if expected == datasetter.Ignore {
+				continue
+			}
+			targets[row*seqLen+i] = expected
+			mask[row*seqLen+i] = 1
+		}
+	}
+	return datasetter.NewBatch(size, seqLen, inputs, targets, mask), nil
+}
+
+// ReadInputVector returns the input vector until it reach the penultimate token
+func (s *Section) ReadInputVector(g *G.ExprGraph) (*G.Node, error) {
+	if s.offset == len(s.sentence)-1 {
+		return nil, io.EOF
+	}
+	backend := make([]float32, s.vocabSize)
+	backend[s.sentence[s.offset]] = 1
+	inputTensor := tensor.New(tensor.WithShape(s.vocabSize), tensor.WithBacking(backend))
+	node := G.NewVector(g, tensor.Float32, G.WithName(fmt.Sprintf("input_%v", s.offset)), G.WithShape(s.vocabSize), G.WithValue(inputTensor))
+	s.offset++
+	return node, nil
+}
+
+// WriteComputedVector add the computed vectors to the output
+func (s *Section) WriteComputedVector(n *G.Node) error {
+	s.output = append(s.output, n)
+	return nil
+}
+
+// GetComputedVectors ..
+func (s *Section) GetComputedVectors() G.Nodes {
+	return s.output
+}
+
+// GetExpectedValue returns the encoded value of the token next to the one present at offset.
+// The tokens of the question and the separator are not learnt, so it returns datasetter.Ignore
+// before the separator
+func (s *Section) GetExpectedValue(offset int) (int, error) {
+	if offset < s.separator {
+		return datasetter.Ignore, nil
+	}
+	return s.sentence[offset+1], nil
+}
+
+// Len returns the number of input vectors of the section
+func (s *Section) Len() int {
+	return len(s.sentence) - 1
+}
+
+// GetInputValue returns the encoded value of the token present at offset
+func (s *Section) GetInputValue(offset int) (int, error) {
+	return s.sentence[offset], nil
+}
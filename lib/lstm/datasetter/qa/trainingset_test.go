@@ -0,0 +1,90 @@
+package qa
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/owulveryck/lstm/datasetter"
+	"github.com/owulveryck/lstm/datasetter/char"
+)
+
+var testTokens = []string{"\n", Separator, char.EndOfSequence, "apa", "kabar", "baik", "siapa", "kamu", "aku", "iteung"}
+
+func runeToIdx(tk string) (int, error) {
+	for i, t := range testTokens {
+		if t == tk {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown token %v", tk)
+}
+
+const corpus = "apa kabar\nbaik\n\nsiapa kamu\naku\niteung\n\n"
+
+func TestTrainingSet(t *testing.T) {
+	tset, err := NewTrainingSet(strings.NewReader(corpus), runeToIdx, len(testTokens))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trainer, err := tset.GetTrainer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	section := trainer.(*Section)
+	// apa kabar <sep> baik <eos>
+	if !reflect.DeepEqual(section.sentence, []int{3, 4, 1, 5, 2}) {
+		t.Fatalf("bad sentence %v", section.sentence)
+	}
+	var expected []int
+	for i := 0; i < section.Len(); i++ {
+		v, _ := section.GetExpectedValue(i)
+		expected = append(expected, v)
+	}
+	if !reflect.DeepEqual(expected, []int{datasetter.Ignore, datasetter.Ignore, 5, 2}) {
+		t.Fatalf("the question should be ignored, got %v", expected)
+	}
+	trainer, err = tset.GetTrainer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the lines of an answer are joined
+	if sentence := trainer.(*Section).sentence; !reflect.DeepEqual(sentence, []int{6, 7, 1, 8, 9, 2}) {
+		t.Fatalf("bad sentence %v", sentence)
+	}
+	if _, err := tset.GetTrainer(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestGetBatch(t *testing.T) {
+	tset, err := NewTrainingSet(strings.NewReader(corpus), runeToIdx, len(testTokens))
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := tset.GetBatch(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shape := batch.Inputs.Shape(); shape[0] != 2 || shape[1] != 5 {
+		t.Fatalf("bad shape %v", shape)
+	}
+	mask := batch.Mask.Data().([]float32)
+	if !reflect.DeepEqual(mask, []float32{0, 0, 1, 1, 0, 0, 0, 1, 1, 1}) {
+		t.Fatalf("bad mask %v", mask)
+	}
+}
+
+func TestMissingSeparator(t *testing.T) {
+	noSeparator := func(tk string) (int, error) {
+		if tk == Separator {
+			return 0, fmt.Errorf("unknown token %v", tk)
+		}
+		return runeToIdx(tk)
+	}
+	if _, err := NewTrainingSet(strings.NewReader(corpus), noSeparator, len(testTokens)); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,74 @@
+package lstm
+
+import (
+	"errors"
+	"math/rand"
+
+	G "gorgonia.org/gorgonia"
+)
+
+// Dropout holds the probabilities of dropping the units of the cell during the training.
+// A dropped unit is set to zero and the kept ones are scaled by 1/(1-p), so nothing changes
+// when the model predicts or is evaluated without dropout.
+// See also https://arxiv.org/abs/1512.05287 for the recurrent dropout
+type Dropout struct {
+	// Input drops the elements of the input xₜ of every time step
+	Input float64
+	// Recurrent drops the elements of hₜ₋₁ entering the gates, with one mask per sequence
+	// shared by its time steps
+	Recurrent float64
+	// Output drops the elements of hₜ before Wy at every time step
+	Output float64
+}
+
+// WithDropout drops units of the cell during the training; Predict and Evaluate never drop any.
+// The masks are drawn from the seed of the model and the number of the step, so a resumed training
+// draws the masks of the uninterrupted one.
+// The sequences must implement datasetter.IndexTrainer or be read by batches
+func WithDropout(d Dropout) TrainOpt {
+	return func(o *trainOptions) {
+		o.dropout = d
+	}
+}
+
+func (d Dropout) enabled() bool {
+	return d.Input > 0 || d.Recurrent > 0 || d.Output > 0
+}
+
+func (d Dropout) validate() error {
+	for _, p := range []float64{d.Input, d.Recurrent, d.Output} {
+		if p < 0 || p >= 1 {
+			return errors.New("a dropout probability must be in [0, 1)")
+		}
+	}
+	return nil
+}
+
+// dropoutSource returns the source of the masks of step, derived from the seed of the model
+func dropoutSource(seed int64, step int) *rand.Rand {
+	return rand.New(rand.NewSource(seed ^ int64(step)*0x5851f42d4c957f2d))
+}
+
+// fillMask draws the values of a dropout mask: 0 with probability p, 1/(1-p) otherwise
+func fillMask(rnd *rand.Rand, mask []float32, p float64) {
+	keep := float32(1 / (1 - p))
+	for i := range mask {
+		if rnd.Float64() < p {
+			mask[i] = 0
+		} else {
+			mask[i] = keep
+		}
+	}
+}
+
+// dropoutMasks returns the nodes of n masks of (B × size), nil if p is zero
+func dropoutMasks(p float64, n int, matrix func(i int) *G.Node) G.Nodes {
+	if p == 0 {
+		return nil
+	}
+	masks := make(G.Nodes, n)
+	for i := range masks {
+		masks[i] = matrix(i)
+	}
+	return masks
+}
@@ -0,0 +1,103 @@
+package lstm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	G "gorgonia.org/gorgonia"
+)
+
+func TestFillMask(t *testing.T) {
+	mask := make([]float32, 10000)
+	fillMask(dropoutSource(1, 1), mask, 0.25)
+	dropped := 0
+	for _, v := range mask {
+		switch v {
+		case 0:
+			dropped++
+		case float32(1 / 0.75):
+		default:
+			t.Fatalf("a mask value is 0 or 1/(1-p), got %v", v)
+		}
+	}
+	if math.Abs(float64(dropped)/float64(len(mask))-0.25) > 0.02 {
+		t.Fatalf("expected a quarter of the units to be dropped, got %v", dropped)
+	}
+}
+
+func TestDropout(t *testing.T) {
+	dropout := Dropout{Input: 0.2, Recurrent: 0.3, Output: 0.4}
+	newModel := func() *Model {
+		return NewModel(5, 5, 4, WithSeed(3))
+	}
+	train := func(opts ...TrainOpt) []byte {
+		m := newModel()
+		if _, err := NewTrainer(m, G.NewVanillaSolver(), append([]TrainOpt{WithEpochs(2)}, opts...)...).Run(context.Background(), newShuffledSet(7)); err != io.EOF {
+			t.Fatalf("expected io.EOF, got %v", err)
+		}
+		return modelWeights(t, m)
+	}
+	dropped := train(WithDropout(dropout))
+	if !bytes.Equal(dropped, train(WithDropout(dropout))) {
+		t.Fatal("the dropout masks should be drawn from the seed of the model")
+	}
+	if bytes.Equal(dropped, train()) {
+		t.Fatal("the dropout should change the training")
+	}
+
+	// a training resumed after its third step draws the masks of the uninterrupted one
+	stop := errors.New("stop")
+	m := newModel()
+	tset := newShuffledSet(7)
+	trainer := NewTrainer(m, G.NewVanillaSolver(), WithEpochs(2), WithDropout(dropout))
+	trainer.OnStep(func(infos TrainingInfos) error {
+		if infos.Step == 3 {
+			return stop
+		}
+		return nil
+	})
+	infos, err := trainer.Run(context.Background(), tset)
+	if err != stop {
+		t.Fatalf("expected the error of the hook, got %v", err)
+	}
+	if _, err := NewTrainer(m, G.NewVanillaSolver(), WithEpochs(2), WithDropout(dropout), WithResume(infos.State)).Run(context.Background(), tset); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if !bytes.Equal(dropped, modelWeights(t, m)) {
+		t.Fatal("the resumed training should end with the weights of the uninterrupted one")
+	}
+
+	if _, err := NewTrainer(newModel(), G.NewVanillaSolver(), WithDropout(Dropout{Output: 1})).Run(context.Background(), newShuffledSet(7)); err == nil {
+		t.Fatal("a dropout probability of 1 should be refused")
+	}
+}
+
+func TestDropoutOnlyInTraining(t *testing.T) {
+	m := NewModel(5, 5, 4, WithSeed(3))
+	before, err := m.Evaluate(context.Background(), newShuffledSet(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// with a learn rate of zero the weights are kept, only the cost of the steps is changed by the dropout
+	cost := func(opts ...TrainOpt) float32 {
+		infos, err := NewTrainer(m, G.NewVanillaSolver(G.WithLearnRate(0)), opts...).Run(context.Background(), newShuffledSet(7))
+		if err != io.EOF {
+			t.Fatalf("expected io.EOF, got %v", err)
+		}
+		return infos.Cost
+	}
+	if cost() == cost(WithDropout(Dropout{Output: 0.5})) {
+		t.Fatal("the dropout should change the cost of the training")
+	}
+	after, err := m.Evaluate(context.Background(), newShuffledSet(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != after {
+		t.Fatalf("the evaluation should not drop any unit, got %v then %v", before, after)
+	}
+}
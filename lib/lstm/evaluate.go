@@ -0,0 +1,82 @@
+package lstm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/owulveryck/lstm/datasetter"
+)
+
+// Evaluation is the loss of the model on a dataset
+type Evaluation struct {
+	// Loss is the mean negative log-likelihood of the expected tokens, in nats
+	Loss float32
+	// Perplexity is e^Loss
+	Perplexity float32
+	// Tokens is the number of expected tokens evaluated
+	Tokens int
+}
+
+// Evaluate reads every sequence of dset and returns the mean loss of the model on its expected tokens.
+// Every sequence starts with a zero memory and the positions expecting datasetter.Ignore are skipped.
+// The sequences must implement datasetter.IndexTrainer; the weights are not modified
+func (m *Model) Evaluate(ctx context.Context, dset datasetter.FullTrainer) (Evaluation, error) {
+	stepper, err := m.newStepper()
+	if err != nil {
+		return Evaluation{}, err
+	}
+	zero := make([]float32, m.hiddenSize)
+	input := make([]float32, m.inputSize)
+	var loss float64
+	var tokens int
+	for {
+		select {
+		case <-ctx.Done():
+			return Evaluation{}, ctx.Err()
+		default:
+		}
+		trainer, err := dset.GetTrainer()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Evaluation{}, err
+		}
+		sequence, ok := trainer.(datasetter.IndexTrainer)
+		if !ok {
+			return Evaluation{}, errors.New("only an IndexTrainer can be evaluated")
+		}
+		stepper.setState(zero, zero)
+		for i := 0; i < sequence.Len(); i++ {
+			idx, err := sequence.GetInputValue(i)
+			if err != nil {
+				return Evaluation{}, err
+			}
+			oneHot(input, idx)
+			output, err := stepper.step(input)
+			if err != nil {
+				return Evaluation{}, err
+			}
+			expected, err := sequence.GetExpectedValue(i)
+			if err != nil {
+				return Evaluation{}, err
+			}
+			if expected == datasetter.Ignore {
+				continue
+			}
+			loss -= math.Log(float64(output[expected]))
+			tokens++
+		}
+	}
+	if tokens == 0 {
+		return Evaluation{}, errors.New("no expected token to evaluate")
+	}
+	loss /= float64(tokens)
+	return Evaluation{
+		Loss:       float32(loss),
+		Perplexity: float32(math.Exp(loss)),
+		Tokens:     tokens,
+	}, nil
+}
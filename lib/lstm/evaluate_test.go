@@ -0,0 +1,124 @@
+package lstm
+
+import (
+	"context"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/owulveryck/lstm/datasetter"
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+// finiteSet returns the sequence count times
+type finiteSet struct {
+	sequenceSet
+	count int
+}
+
+func (s *finiteSet) GetTrainer() (datasetter.Trainer, error) {
+	if s.count == 0 {
+		return nil, io.EOF
+	}
+	s.count--
+	return s.sequenceSet.GetTrainer()
+}
+
+func TestEvaluate(t *testing.T) {
+	hiddenSize := 4
+	back := testBackends(5, 5, hiddenSize)
+	back.Wy = G.Gaussian32(0, 1, 5, hiddenSize)
+	back.Wi = G.Gaussian32(0, 1, hiddenSize, 5)
+	sequence := sequenceSet{inputs: []int{0, 1, 2, 3, 4}, targets: []int{datasetter.Ignore, 2, 3, 4, 0}}
+	m := newModelFromBackends(back)
+	evaluation, err := m.Evaluate(context.Background(), &finiteSet{sequenceSet: sequence, count: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evaluation.Tokens != 12 {
+		t.Fatalf("expected 12 tokens, got %v", evaluation.Tokens)
+	}
+	// every sequence starts with a zero memory, so the mean loss is the one of a single sequence
+	trainer, _ := sequence.GetTrainer()
+	hiddenT := tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(hiddenSize))
+	cellT := tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(hiddenSize))
+	cost, _, err := newModelFromBackends(cloneBackends(back)).trainStep(trainer, G.NewVanillaSolver(G.WithLearnRate(0)), newGraphCache(), hiddenT, cellT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(float64(evaluation.Loss-cost)) > 1e-4 {
+		t.Fatalf("the loss is %v, the training cost gives %v", evaluation.Loss, cost)
+	}
+	if math.Abs(float64(evaluation.Perplexity)-math.Exp(float64(evaluation.Loss))) > 1e-3 {
+		t.Fatalf("bad perplexity %v", evaluation.Perplexity)
+	}
+}
+
+func TestEarlyStop(t *testing.T) {
+	m := newModelFromBackends(testBackends(5, 5, 4))
+	sequence := sequenceSet{inputs: []int{0, 1, 2, 3}, targets: []int{1, 2, 3, 4}}
+	validation := func() (datasetter.FullTrainer, error) {
+		return &finiteSet{sequenceSet: sequence, count: 2}, nil
+	}
+	// the weights are never updated, so the validation loss never improves after the first evaluation
+	infoChan, errc := m.Train(context.Background(), sequence, G.NewVanillaSolver(G.WithLearnRate(0)), make(chan struct{}), WithValidation(validation, 2, 3))
+	var validated []TrainingInfos
+	for infos := range infoChan {
+		if infos.Validated {
+			validated = append(validated, infos)
+		}
+	}
+	if err := <-errc; err != ErrEarlyStop {
+		t.Fatalf("expected ErrEarlyStop, got %v", err)
+	}
+	if len(validated) != 4 {
+		t.Fatalf("expected 4 evaluations, got %v", len(validated))
+	}
+	for i, infos := range validated {
+		if infos.Step != 2*(i+1) {
+			t.Fatalf("evaluation %v at step %v", i, infos.Step)
+		}
+		if infos.Best != (i == 0) {
+			t.Fatalf("only the first evaluation is the best one, got %v", validated)
+		}
+	}
+}
+
+// rewindSet returns the sequence count times per epoch
+type rewindSet struct {
+	finiteSet
+	perEpoch int
+	rewinds  int
+	reads    int
+}
+
+func (s *rewindSet) GetTrainer() (datasetter.Trainer, error) {
+	trainer, err := s.finiteSet.GetTrainer()
+	if err == nil {
+		s.reads++
+	}
+	return trainer, err
+}
+
+func (s *rewindSet) Rewind() {
+	s.rewinds++
+	s.count = s.perEpoch
+}
+
+func TestEpochs(t *testing.T) {
+	m := newModelFromBackends(testBackends(5, 5, 4))
+	dset := &rewindSet{
+		finiteSet: finiteSet{sequenceSet: sequenceSet{inputs: []int{0, 1, 2}, targets: []int{1, 2, 3}}, count: 2},
+		perEpoch:  2,
+	}
+	infoChan, errc := m.Train(context.Background(), dset, G.NewVanillaSolver(G.WithLearnRate(0)), make(chan struct{}), WithEpochs(3))
+	for range infoChan {
+	}
+	if err := <-errc; err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if dset.rewinds != 2 || dset.reads != 6 {
+		t.Fatalf("expected 2 rewinds and 6 sequences, got %v and %v", dset.rewinds, dset.reads)
+	}
+}
@@ -0,0 +1,115 @@
+package lstm
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Initializer draws the initial values of a rows×cols weight matrix from rnd.
+// The matrices of the model multiply their input, so cols is the fan-in and rows the fan-out
+type Initializer func(rnd *rand.Rand, rows, cols int) []float32
+
+// Gaussian draws the weights from N(mean, stdev²). Gaussian(0, 0.08) is the default initializer of the model
+func Gaussian(mean, stdev float64) Initializer {
+	return func(rnd *rand.Rand, rows, cols int) []float32 {
+		return gaussian32(rnd, mean, stdev, rows, cols)
+	}
+}
+
+// GlorotNormal draws the weights from N(0, gain²·2/(fanIn+fanOut)), as gorgonia's GlorotEtAlN32.
+// See also: http://jmlr.org/proceedings/papers/v9/glorot10a/glorot10a.pdf
+func GlorotNormal(gain float64) Initializer {
+	return func(rnd *rand.Rand, rows, cols int) []float32 {
+		return gaussian32(rnd, 0, gain*math.Sqrt(2/float64(rows+cols)), rows, cols)
+	}
+}
+
+// HeNormal draws the weights from N(0, gain²·2/fanIn): HeNormal(1) is the initialization of He et al.
+// gorgonia's HeEtAlN64 leaves the 2 to the gain, which must be √2 for the same variance.
+// See also https://arxiv.org/abs/1502.01852
+func HeNormal(gain float64) Initializer {
+	return func(rnd *rand.Rand, rows, cols int) []float32 {
+		return gaussian32(rnd, 0, gain*math.Sqrt(2/float64(cols)), rows, cols)
+	}
+}
+
+// Orthogonal draws a random matrix whose rows, or columns if there are fewer, are orthonormal, then scales it by gain.
+// It keeps the norm of the state through the recurrent matrices.
+// See also https://arxiv.org/abs/1312.6120
+func Orthogonal(gain float64) Initializer {
+	return func(rnd *rand.Rand, rows, cols int) []float32 {
+		// the n vectors of size m are orthonormalized, n ≤ m
+		n, m := rows, cols
+		if n > m {
+			n, m = m, n
+		}
+		q := make([][]float64, n)
+		for i := range q {
+			q[i] = make([]float64, m)
+			for j := range q[i] {
+				q[i][j] = rnd.NormFloat64()
+			}
+		}
+		// modified Gram-Schmidt
+		for i := range q {
+			for k := 0; k < i; k++ {
+				var dot float64
+				for j := range q[i] {
+					dot += q[i][j] * q[k][j]
+				}
+				for j := range q[i] {
+					q[i][j] -= dot * q[k][j]
+				}
+			}
+			var norm float64
+			for _, v := range q[i] {
+				norm += v * v
+			}
+			norm = math.Sqrt(norm)
+			for j := range q[i] {
+				q[i][j] /= norm
+			}
+		}
+		values := make([]float32, rows*cols)
+		for r := 0; r < rows; r++ {
+			for c := 0; c < cols; c++ {
+				if rows <= cols {
+					values[r*cols+c] = float32(gain * q[r][c])
+				} else {
+					values[r*cols+c] = float32(gain * q[c][r])
+				}
+			}
+		}
+		return values
+	}
+}
+
+// WithInputInit draws the input matrices Wᵢ, Wₒ, Wf and Wc of the gates with init
+func WithInputInit(init Initializer) ModelOpt {
+	return func(o *modelOptions) {
+		o.inputInit = init
+	}
+}
+
+// WithRecurrentInit draws the recurrent matrices Uᵢ, Uₒ, Uf and Uc of the gates with init,
+// usually Orthogonal(1)
+func WithRecurrentInit(init Initializer) ModelOpt {
+	return func(o *modelOptions) {
+		o.recurrentInit = init
+	}
+}
+
+// WithOutputInit draws the output matrix Wy with init
+func WithOutputInit(init Initializer) ModelOpt {
+	return func(o *modelOptions) {
+		o.outputInit = init
+	}
+}
+
+// WithForgetBias sets the initial bias of the forget gate, usually 1 so the memory is kept
+// at the start of the training. The other biases are zero
+func WithForgetBias(bias float32) ModelOpt {
+	return func(o *modelOptions) {
+		o.forgetBias = bias
+	}
+}
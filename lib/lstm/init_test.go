@@ -0,0 +1,85 @@
+package lstm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestOrthogonal(t *testing.T) {
+	for _, shape := range [][2]int{{6, 6}, {3, 7}, {7, 3}} {
+		rows, cols := shape[0], shape[1]
+		w := Orthogonal(2)(rand.New(rand.NewSource(1)), rows, cols)
+		// the rows, or the columns of a tall matrix, are orthogonal with a norm of the gain
+		n, m := rows, cols
+		at := func(i, j int) float64 { return float64(w[i*cols+j]) }
+		if rows > cols {
+			n, m = cols, rows
+			at = func(i, j int) float64 { return float64(w[j*cols+i]) }
+		}
+		for i := 0; i < n; i++ {
+			for k := 0; k < n; k++ {
+				var dot float64
+				for j := 0; j < m; j++ {
+					dot += at(i, j) * at(k, j)
+				}
+				expected := 0.0
+				if i == k {
+					expected = 4
+				}
+				if math.Abs(dot-expected) > 1e-4 {
+					t.Fatalf("%vx%v: expected a dot product of %v between the vectors %v and %v, got %v", rows, cols, expected, i, k, dot)
+				}
+			}
+		}
+	}
+}
+
+func TestInitializers(t *testing.T) {
+	stdev := func(w []float32) float64 {
+		var sum float64
+		for _, v := range w {
+			sum += float64(v) * float64(v)
+		}
+		return math.Sqrt(sum / float64(len(w)))
+	}
+	rnd := rand.New(rand.NewSource(1))
+	if s := stdev(GlorotNormal(1)(rnd, 100, 300)); math.Abs(s-math.Sqrt(2.0/400)) > 0.005 {
+		t.Fatalf("bad standard deviation of the Glorot weights %v", s)
+	}
+	// the variance of the He weights is 2/fanIn
+	if s := stdev(HeNormal(1)(rnd, 100, 400)); math.Abs(s*s-2.0/400)/(2.0/400) > 0.05 {
+		t.Fatalf("bad variance of the He weights %v, expected %v", s*s, 2.0/400)
+	}
+}
+
+func TestModelInit(t *testing.T) {
+	m := NewModel(5, 7, 4, WithSeed(1), WithRecurrentInit(Orthogonal(1)), WithOutputInit(Gaussian(0, 0)), WithForgetBias(1))
+	for _, b := range m.biasF {
+		if b != 1 {
+			t.Fatalf("the forget bias should be 1, got %v", m.biasF)
+		}
+	}
+	for _, b := range m.biasI {
+		if b != 0 {
+			t.Fatalf("the other biases should be zero, got %v", m.biasI)
+		}
+	}
+	for _, w := range m.wy {
+		if w != 0 {
+			t.Fatalf("the output weights should be drawn by their initializer, got %v", m.wy)
+		}
+	}
+	// the recurrent matrix of the input gate is square and orthogonal
+	var dot float64
+	for j := 0; j < 4; j++ {
+		dot += float64(m.ui[j]) * float64(m.ui[4+j])
+	}
+	if math.Abs(dot) > 1e-5 {
+		t.Fatalf("the recurrent weights should be orthogonal, got a dot product of %v", dot)
+	}
+	// the default initialization is unchanged
+	if err := areEquals(NewModel(5, 7, 4, WithSeed(1), WithInputInit(Gaussian(0, 0.08))), NewModel(5, 7, 4, WithSeed(1))); err != nil {
+		t.Fatal(err)
+	}
+}
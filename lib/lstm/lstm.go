@@ -7,44 +7,105 @@ import (
 	G "gorgonia.org/gorgonia"
 )
 
-// forwardStep as described here https://en.wikipedia.org/wiki/Long_short-term_memory#LSTM_with_a_forget_gate
+// forwardStep unrolls the cell over every input vector of the dataSet, starting from prevHidden and prevCell.
+// Each computed output is written back to the dataSet.
 // It returns the last hidden node and the last cell node
-func (l *lstm) forwardStep(dataSet datasetter.ReadWriter, prevHidden, prevCell *G.Node, step int) (*G.Node, *G.Node, error) {
-	// Read the current input vector
-	inputVector, err := dataSet.ReadInputVector(l.g)
+func (l *lstm) forwardStep(dataSet datasetter.ReadWriter, prevHidden, prevCell *G.Node) (*G.Node, *G.Node, error) {
+	for {
+		// Read the current input vector
+		inputVector, err := dataSet.ReadInputVector(l.g)
+		switch {
+		case err != nil && err != io.EOF:
+			return prevHidden, prevCell, err
+		case err == io.EOF:
+			return prevHidden, prevCell, nil
+		}
+		hidden, cell, y, err := l.step(inputVector, prevHidden, prevCell)
+		if err != nil {
+			return prevHidden, prevCell, err
+		}
+		if err := dataSet.WriteComputedVector(y); err != nil {
+			return prevHidden, prevCell, err
+		}
+		prevHidden, prevCell = hidden, cell
+	}
+}
 
-	switch {
-	case err != nil && err != io.EOF:
-		return prevHidden, prevCell, err
-	case err == io.EOF:
-		return prevHidden, prevCell, nil
-	}
-	// Helper function for clarity
-	// r is a replacer that will change ₜ and ₜ₋₁ for step and step-1
-	// this is to avoid conflict in the graph due to the recursion
-	r := replace(`ₜ`, step)
-	set := func(ident, equation string) *G.Node {
-		//log.Printf("==> %v=%v", r.Replace(ident), r.Replace(equation))
-		res, _ := l.parser.Parse(r.Replace(equation))
-		l.parser.Set(r.Replace(ident), res)
-		return res
+// step adds a single time step of the cell to the graph,
+// as described here https://en.wikipedia.org/wiki/Long_short-term_memory#LSTM_with_a_forget_gate
+//
+//	iₜ = σ(Wᵢ·xₜ+Uᵢ·hₜ₋₁+Bᵢ)
+//	fₜ = σ(Wf·xₜ+Uf·hₜ₋₁+Bf)
+//	oₜ = σ(Wₒ·xₜ+Uₒ·hₜ₋₁+Bₒ)
+//	ĉₜ = tanh(Wc·xₜ+Uc·hₜ₋₁+Bc)
+//	cₜ = fₜ*cₜ₋₁ + iₜ*ĉₜ
+//	hₜ = oₜ*tanh(cₜ)
+//	yₜ = softmax(Wy·hₜ+By)
+func (l *lstm) step(x, prevHidden, prevCell *G.Node) (hidden, cell, y *G.Node, err error) {
+	// gate computes activation(W·xₜ+U·hₜ₋₁+B)
+	gate := func(w, u, b *G.Node, activation func(*G.Node) (*G.Node, error)) (*G.Node, error) {
+		wx, err := G.Mul(w, x)
+		if err != nil {
+			return nil, err
+		}
+		uh, err := G.Mul(u, prevHidden)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := G.Add(wx, uh)
+		if err != nil {
+			return nil, err
+		}
+		if sum, err = G.Add(sum, b); err != nil {
+			return nil, err
+		}
+		return activation(sum)
+	}
+	var i, f, o, candidate *G.Node
+	if i, err = gate(l.wi, l.ui, l.biasI, G.Sigmoid); err != nil {
+		return nil, nil, nil, err
+	}
+	if f, err = gate(l.wf, l.uf, l.biasF, G.Sigmoid); err != nil {
+		return nil, nil, nil, err
+	}
+	if o, err = gate(l.wo, l.uo, l.biasO, G.Sigmoid); err != nil {
+		return nil, nil, nil, err
+	}
+	if candidate, err = gate(l.wc, l.uc, l.biasC, G.Tanh); err != nil {
+		return nil, nil, nil, err
 	}
 
-	l.parser.Set(r.Replace(`xₜ`), inputVector)
-	if step == 0 {
-		l.parser.Set(r.Replace(`hₜ₋₁`), prevHidden)
-		l.parser.Set(r.Replace(`cₜ₋₁`), prevCell)
+	// cₜ = fₜ*cₜ₋₁ + iₜ*ĉₜ
+	var forget, write *G.Node
+	if forget, err = G.HadamardProd(f, prevCell); err != nil {
+		return nil, nil, nil, err
+	}
+	if write, err = G.HadamardProd(i, candidate); err != nil {
+		return nil, nil, nil, err
+	}
+	if cell, err = G.Add(forget, write); err != nil {
+		return nil, nil, nil, err
+	}
 
+	// hₜ = oₜ*tanh(cₜ)
+	var tanhCell *G.Node
+	if tanhCell, err = G.Tanh(cell); err != nil {
+		return nil, nil, nil, err
+	}
+	if hidden, err = G.HadamardProd(o, tanhCell); err != nil {
+		return nil, nil, nil, err
 	}
-	set(`iₜ`, `σ(Wᵢ·xₜ+Uᵢ·hₜ₋₁+Bᵢ)`)
-	set(`fₜ`, `σ(Wf·xₜ+Uf·hₜ₋₁+Bf)`) // dot product made with ctrl+k . M
-	set(`oₜ`, `σ(Wₒ·xₜ+Uₒ·hₜ₋₁+Bₒ)`)
-	// ċₜis a vector of new candidates value
-	set(`ĉₜ`, `tanh(Wc·xₜ+Uc·hₜ₋₁+Bc)`) // c made with ctrl+k c >
-	ct := set(`cₜ`, `(fₜ*cₜ₋₁)+(iₜ*ĉₜ)`)
-	ht := set(`hₜ`, `oₜ*tanh(cₜ)`)
-	y := set(`yₜ`, `softmax(Wy·hₜ+By)`)
 
-	dataSet.WriteComputedVector(y)
-	return l.forwardStep(dataSet, ht, ct, step+1)
+	// yₜ = softmax(Wy·hₜ+By)
+	var wyh, logits *G.Node
+	if wyh, err = G.Mul(l.wy, hidden); err != nil {
+		return nil, nil, nil, err
+	}
+	if logits, err = G.Add(wyh, l.biasY); err != nil {
+		return nil, nil, nil, err
+	}
+	if y, err = G.SoftMax(logits); err != nil {
+		return nil, nil, nil, err
+	}
+	return hidden, cell, y, nil
 }
@@ -1,8 +1,13 @@
 package lstm
 
 import (
+	"io"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/gorgonia/parser"
+	"github.com/owulveryck/lstm/datasetter"
 	G "gorgonia.org/gorgonia"
 	"gorgonia.org/tensor"
 )
@@ -21,7 +26,7 @@ func TestForwardStep(t *testing.T) {
 	cellT := tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(model.hiddenSize))
 	lstm := model.newLSTM(hiddenT, cellT)
 	//lstm := model.newLSTM()
-	_, _, err := lstm.forwardStep(tset, lstm.prevHidden, lstm.prevCell, 0)
+	_, _, err := lstm.forwardStep(tset, lstm.prevHidden, lstm.prevCell)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -34,3 +39,127 @@ func TestForwardStep(t *testing.T) {
 		t.Log(computedVector.Value().Data().([]float32))
 	}
 }
+
+// replace is stupid function to replace the value of subscript and subscript-1 with an integer
+// caution: no error checking is performed
+func replace(subscript string, value int) *strings.Replacer {
+	script := strings.NewReplacer(
+		`1`, `₁`,
+		`2`, `₂`,
+		`3`, `₃`,
+		`4`, `₄`,
+		`5`, `₅`,
+		`6`, `₆`,
+		`7`, `₇`,
+		`8`, `₈`,
+		`9`, `₉`,
+		`0`, `₀`,
+		`-`, `₋`)
+	r := strings.NewReplacer(subscript+`₋₁`, script.Replace(strconv.Itoa(value-1)), subscript, script.Replace(strconv.Itoa(value)))
+	return r
+}
+
+// formulaStep is the former implementation of forwardStep: every gate is parsed from its formula
+// and the graph is unrolled recursively. It is kept as a reference for the direct implementation
+func formulaStep(l *lstm, p *parser.Parser, dataSet datasetter.ReadWriter, prevHidden, prevCell *G.Node, step int) (*G.Node, *G.Node, error) {
+	inputVector, err := dataSet.ReadInputVector(l.g)
+	switch {
+	case err != nil && err != io.EOF:
+		return prevHidden, prevCell, err
+	case err == io.EOF:
+		return prevHidden, prevCell, nil
+	}
+	r := replace(`ₜ`, step)
+	set := func(ident, equation string) *G.Node {
+		res, _ := p.Parse(r.Replace(equation))
+		p.Set(r.Replace(ident), res)
+		return res
+	}
+
+	p.Set(r.Replace(`xₜ`), inputVector)
+	if step == 0 {
+		p.Set(r.Replace(`hₜ₋₁`), prevHidden)
+		p.Set(r.Replace(`cₜ₋₁`), prevCell)
+	}
+	set(`iₜ`, `σ(Wᵢ·xₜ+Uᵢ·hₜ₋₁+Bᵢ)`)
+	set(`fₜ`, `σ(Wf·xₜ+Uf·hₜ₋₁+Bf)`)
+	set(`oₜ`, `σ(Wₒ·xₜ+Uₒ·hₜ₋₁+Bₒ)`)
+	set(`ĉₜ`, `tanh(Wc·xₜ+Uc·hₜ₋₁+Bc)`)
+	ct := set(`cₜ`, `(fₜ*cₜ₋₁)+(iₜ*ĉₜ)`)
+	ht := set(`hₜ`, `oₜ*tanh(cₜ)`)
+	y := set(`yₜ`, `softmax(Wy·hₜ+By)`)
+
+	dataSet.WriteComputedVector(y)
+	return formulaStep(l, p, dataSet, ht, ct, step+1)
+}
+
+func newFormulaParser(l *lstm) *parser.Parser {
+	p := parser.NewParser(l.g)
+	for name, n := range map[string]*G.Node{
+		`Wᵢ`: l.wi, `Uᵢ`: l.ui, `Bᵢ`: l.biasI,
+		`Wₒ`: l.wo, `Uₒ`: l.uo, `Bₒ`: l.biasO,
+		`Wf`: l.wf, `Uf`: l.uf, `Bf`: l.biasF,
+		`Wc`: l.wc, `Uc`: l.uc, `Bc`: l.biasC,
+		`Wy`: l.wy, `By`: l.biasY,
+	} {
+		p.Set(name, n)
+	}
+	return p
+}
+
+func TestForwardStepMatchesFormulas(t *testing.T) {
+	back := testBackends(5, 5, 10)
+	back.Wi = G.Gaussian32(0, 1, 10, 5)
+	back.Ui = G.Gaussian32(0, 1, 10, 10)
+	back.Wf = G.Gaussian32(0, 1, 10, 5)
+	back.Wc = G.Gaussian32(0, 1, 10, 5)
+	back.Wy = G.Gaussian32(0, 1, 5, 10)
+	model := newModelFromBackends(back)
+	values := [][]float32{
+		{1, 0, 0, 0, 0},
+		{0, 1, 0, 0, 0},
+		{0, 0, 1, 0, 0},
+		{0, 0, 0, 1, 0},
+		{0, 0, 0, 0, 1},
+		{0, 1, 0, 0, 0},
+	}
+	initialHidden := G.Gaussian32(0, 1, model.hiddenSize)
+	initialCell := G.Gaussian32(0, 1, model.hiddenSize)
+	run := func(unroll func(l *lstm, tset *testSet) (*G.Node, *G.Node, error)) (outputs [][]float32, hidden, cell []float32) {
+		hiddenT := tensor.New(tensor.WithShape(model.hiddenSize), tensor.WithBacking(append([]float32(nil), initialHidden...)))
+		cellT := tensor.New(tensor.WithShape(model.hiddenSize), tensor.WithBacking(append([]float32(nil), initialCell...)))
+		l := model.newLSTM(hiddenT, cellT)
+		tset := &testSet{values: values}
+		h, c, err := unroll(l, tset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		machine := G.NewTapeMachine(l.g)
+		if err := machine.RunAll(); err != nil {
+			t.Fatal(err)
+		}
+		tset.flush()
+		return tset.outputValues, h.Value().Data().([]float32), c.Value().Data().([]float32)
+	}
+	directOutputs, directHidden, directCell := run(func(l *lstm, tset *testSet) (*G.Node, *G.Node, error) {
+		return l.forwardStep(tset, l.prevHidden, l.prevCell)
+	})
+	formulaOutputs, formulaHidden, formulaCell := run(func(l *lstm, tset *testSet) (*G.Node, *G.Node, error) {
+		return formulaStep(l, newFormulaParser(l), tset, l.prevHidden, l.prevCell, 0)
+	})
+	if len(directOutputs) != len(values) || len(directOutputs) != len(formulaOutputs) {
+		t.Fatalf("expected %v outputs, got %v and %v", len(values), len(directOutputs), len(formulaOutputs))
+	}
+	for i := range directOutputs {
+		for j := range directOutputs[i] {
+			if directOutputs[i][j] != formulaOutputs[i][j] {
+				t.Fatalf("output %v differs: %v != %v", i, directOutputs[i], formulaOutputs[i])
+			}
+		}
+	}
+	for i := range directHidden {
+		if directHidden[i] != formulaHidden[i] || directCell[i] != formulaCell[i] {
+			t.Fatalf("memory differs: %v/%v, %v/%v", directHidden, formulaHidden, directCell, formulaCell)
+		}
+	}
+}
@@ -1,7 +1,8 @@
 package lstm
 
 import (
-	"github.com/gorgonia/parser"
+	"time"
+
 	G "gorgonia.org/gorgonia"
 	"gorgonia.org/tensor"
 )
@@ -30,6 +31,8 @@ type Model struct {
 	inputSize  int
 	outputSize int
 	hiddenSize int
+	// seed is the seed the weights have been drawn with
+	seed int64
 }
 
 // lstm represent a single cell of the RNN
@@ -52,9 +55,8 @@ type lstm struct {
 	uc    *G.Node
 	biasC *G.Node
 
-	wy     *G.Node
-	biasY  *G.Node
-	parser *parser.Parser
+	wy    *G.Node
+	biasY *G.Node
 
 	inputSize  int
 	outputSize int
@@ -68,8 +70,6 @@ func (m *Model) newLSTM(hiddenT, cellT tensor.Tensor) *lstm {
 	lstm := new(lstm)
 	g := G.NewGraph()
 	lstm.g = g
-	p := parser.NewParser(g)
-	lstm.parser = p
 	lstm.hiddenSize = m.hiddenSize
 	lstm.inputSize = m.inputSize
 	lstm.outputSize = m.outputSize
@@ -107,39 +107,25 @@ func (m *Model) newLSTM(hiddenT, cellT tensor.Tensor) *lstm {
 	lstm.wi = G.NewMatrix(g, tensor.Float32, G.WithName("Wᵢ"), G.WithShape(hiddenSize, prevSize), G.WithValue(wiT))
 	lstm.ui = G.NewMatrix(g, tensor.Float32, G.WithName("Uᵢ"), G.WithShape(hiddenSize, hiddenSize), G.WithValue(uiT))
 	lstm.biasI = G.NewVector(g, tensor.Float32, G.WithName("Bᵢ"), G.WithShape(hiddenSize), G.WithValue(biasIT))
-	p.Set(`Wᵢ`, lstm.wi)
-	p.Set(`Uᵢ`, lstm.ui)
-	p.Set(`Bᵢ`, lstm.biasI)
 
 	// output gate weights
 	lstm.wo = G.NewMatrix(g, tensor.Float32, G.WithName("Wₒ"), G.WithShape(hiddenSize, prevSize), G.WithValue(woT))
 	lstm.uo = G.NewMatrix(g, tensor.Float32, G.WithName("Uₒ"), G.WithShape(hiddenSize, hiddenSize), G.WithValue(uoT))
 	lstm.biasO = G.NewVector(g, tensor.Float32, G.WithName("Bₒ"), G.WithShape(hiddenSize), G.WithValue(biasOT))
-	p.Set(`Wₒ`, lstm.wo)
-	p.Set(`Uₒ`, lstm.uo)
-	p.Set(`Bₒ`, lstm.biasO)
 
 	// forget gate weights
 	lstm.wf = G.NewMatrix(g, tensor.Float32, G.WithName("Wf"), G.WithShape(hiddenSize, prevSize), G.WithValue(wfT))
 	lstm.uf = G.NewMatrix(g, tensor.Float32, G.WithName("Uf"), G.WithShape(hiddenSize, hiddenSize), G.WithValue(ufT))
 	lstm.biasF = G.NewVector(g, tensor.Float32, G.WithName("Bf"), G.WithShape(hiddenSize), G.WithValue(biasFT))
-	p.Set(`Wf`, lstm.wf)
-	p.Set(`Uf`, lstm.uf)
-	p.Set(`Bf`, lstm.biasF)
 
 	// cell write
 	lstm.wc = G.NewMatrix(g, tensor.Float32, G.WithName("Wc"), G.WithShape(hiddenSize, prevSize), G.WithValue(wcT))
 	lstm.uc = G.NewMatrix(g, tensor.Float32, G.WithName("Uc"), G.WithShape(hiddenSize, hiddenSize), G.WithValue(ucT))
 	lstm.biasC = G.NewVector(g, tensor.Float32, G.WithName("bc"), G.WithShape(hiddenSize), G.WithValue(biasCT))
-	p.Set(`Wc`, lstm.wc)
-	p.Set(`Uc`, lstm.uc)
-	p.Set(`Bc`, lstm.biasC)
 
 	// Output vector
 	lstm.wy = G.NewMatrix(g, tensor.Float32, G.WithName("Wy"), G.WithShape(outputSize, hiddenSize), G.WithValue(wyT))
 	lstm.biasY = G.NewVector(g, tensor.Float32, G.WithName("by"), G.WithShape(outputSize), G.WithValue(biasYT))
-	p.Set(`Wy`, lstm.wy)
-	p.Set(`By`, lstm.biasY)
 
 	// this is to simulate a default "previous" state
 	lstm.prevHidden = G.NewVector(g, tensor.Float32, G.WithName("hₜ₋₁"), G.WithShape(hiddenSize), G.WithValue(hiddenT))
@@ -153,6 +139,7 @@ func newModelFromBackends(back *backends) *Model {
 	m.hiddenSize = back.HiddenSize
 	m.inputSize = back.InputSize
 	m.outputSize = back.OutputSize
+	m.seed = back.Seed
 
 	// input gate weights
 	m.wi = back.Wi
@@ -180,7 +167,57 @@ func newModelFromBackends(back *backends) *Model {
 	return m
 }
 
+// ModelConfig holds the sizes of a model
+type ModelConfig struct {
+	InputSize  int
+	OutputSize int
+	HiddenSize int
+}
+
+// Config returns the sizes of the model
+func (m *Model) Config() ModelConfig {
+	return ModelConfig{
+		InputSize:  m.inputSize,
+		OutputSize: m.outputSize,
+		HiddenSize: m.hiddenSize,
+	}
+}
+
+// ModelOpt is an option of NewModel
+type ModelOpt func(o *modelOptions)
+
+type modelOptions struct {
+	seed          int64
+	inputInit     Initializer
+	recurrentInit Initializer
+	outputInit    Initializer
+	forgetBias    float32
+}
+
+// WithSeed draws the initial weights from a source seeded with seed, so two models created
+// with the same seed and sizes are identical. The default seed is the current time
+func WithSeed(seed int64) ModelOpt {
+	return func(o *modelOptions) {
+		o.seed = seed
+	}
+}
+
 // NewModel creates a new model
-func NewModel(inputSize, outputSize int, hiddenSize int) *Model {
-	return newModelFromBackends(initBackends(inputSize, outputSize, hiddenSize))
+func NewModel(inputSize, outputSize int, hiddenSize int, opts ...ModelOpt) *Model {
+	options := modelOptions{
+		seed:          time.Now().UnixNano(),
+		inputInit:     Gaussian(0, 0.08),
+		recurrentInit: Gaussian(0, 0.08),
+		outputInit:    Gaussian(0, 0.08),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return newModelFromBackends(initBackends(inputSize, outputSize, hiddenSize, options))
+}
+
+// Seed returns the seed the weights of the model have been drawn with, so the randomness of a training
+// can be derived from it. It is zero for the models saved before the seed was recorded
+func (m *Model) Seed() int64 {
+	return m.seed
 }
@@ -3,8 +3,7 @@ package lstm
 import (
 	"bytes"
 	"encoding/gob"
-
-	G "gorgonia.org/gorgonia"
+	"math/rand"
 )
 
 // backends holds the informations to be saved
@@ -30,6 +29,8 @@ type backends struct {
 
 	Wy    []float32
 	BiasY []float32
+
+	Seed int64
 }
 
 // MarshalBinary for backup. This function saves the content of the weights matrices and the biais but not the graph structure
@@ -38,6 +39,7 @@ func (m Model) MarshalBinary() ([]byte, error) {
 	bkp.InputSize = m.inputSize
 	bkp.OutputSize = m.outputSize
 	bkp.HiddenSize = m.hiddenSize
+	bkp.Seed = m.seed
 	bkp.Wi = m.wi
 	bkp.Ui = m.ui
 	bkp.BiasI = m.biasI
@@ -71,25 +73,43 @@ func (m *Model) UnmarshalBinary(data []byte) error {
 	return nil
 }
 
-// initBackends returns weights initialisation
-func initBackends(inputSize, outputSize int, hiddenSize int) *backends {
+// initBackends returns weights initialisation, drawn by the initializers of options from a source seeded with options.seed
+func initBackends(inputSize, outputSize int, hiddenSize int, options modelOptions) *backends {
+	rnd := rand.New(rand.NewSource(options.seed))
 	var back backends
 	back.InputSize = inputSize
 	back.OutputSize = outputSize
 	back.HiddenSize = hiddenSize
-	back.Wi = G.Gaussian32(0.0, 0.08, hiddenSize, inputSize)
-	back.Ui = G.Gaussian32(0.0, 0.08, hiddenSize, hiddenSize)
+	back.Seed = options.seed
+	back.Wi = options.inputInit(rnd, hiddenSize, inputSize)
+	back.Ui = options.recurrentInit(rnd, hiddenSize, hiddenSize)
 	back.BiasI = make([]float32, hiddenSize)
-	back.Wo = G.Gaussian32(0.0, 0.08, hiddenSize, inputSize)
-	back.Uo = G.Gaussian32(0.0, 0.08, hiddenSize, hiddenSize)
+	back.Wo = options.inputInit(rnd, hiddenSize, inputSize)
+	back.Uo = options.recurrentInit(rnd, hiddenSize, hiddenSize)
 	back.BiasO = make([]float32, hiddenSize)
-	back.Wf = G.Gaussian32(0.0, 0.08, hiddenSize, inputSize)
-	back.Uf = G.Gaussian32(0.0, 0.08, hiddenSize, hiddenSize)
+	back.Wf = options.inputInit(rnd, hiddenSize, inputSize)
+	back.Uf = options.recurrentInit(rnd, hiddenSize, hiddenSize)
 	back.BiasF = make([]float32, hiddenSize)
-	back.Wc = G.Gaussian32(0.0, 0.08, hiddenSize, inputSize)
-	back.Uc = G.Gaussian32(0.0, 0.08, hiddenSize, hiddenSize)
+	for i := range back.BiasF {
+		back.BiasF[i] = options.forgetBias
+	}
+	back.Wc = options.inputInit(rnd, hiddenSize, inputSize)
+	back.Uc = options.recurrentInit(rnd, hiddenSize, hiddenSize)
 	back.BiasC = make([]float32, hiddenSize)
-	back.Wy = G.Gaussian32(0.0, 0.08, outputSize, hiddenSize)
+	back.Wy = options.outputInit(rnd, outputSize, hiddenSize)
 	back.BiasY = make([]float32, outputSize)
 	return &back
 }
+
+// gaussian32 draws the values of a matrix of shape s from a normal distribution
+func gaussian32(rnd *rand.Rand, mean, stdev float64, s ...int) []float32 {
+	size := 1
+	for _, d := range s {
+		size *= d
+	}
+	values := make([]float32, size)
+	for i := range values {
+		values[i] = float32(rnd.NormFloat64()*stdev + mean)
+	}
+	return values
+}
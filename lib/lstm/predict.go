@@ -1,13 +1,12 @@
 package lstm
 
 import (
-	"strings"
 	"context"
-	// "fmt"
 	"io"
+	"strings"
 
 	"github.com/owulveryck/lstm/datasetter"
-	."github.com/owulveryck/lstm/datasetter/char"
+	. "github.com/owulveryck/lstm/datasetter/char"
 	G "gorgonia.org/gorgonia"
 	"gorgonia.org/tensor"
 )
@@ -38,8 +37,19 @@ func (b *basicReadWriter) GetComputedVectors() G.Nodes {
 	return G.Nodes{b.output}
 }
 
-// Predict ...
-func (m *Model) Predict(ctx context.Context, dataSet datasetter.Float32ReadWriter) error {
+// stepper is a one step execution graph of the model.
+// It carries the hidden and the cell states from one step to the next one
+type stepper struct {
+	input      *G.Node
+	prevHidden *G.Node
+	prevCell   *G.Node
+	hidden     *G.Node
+	cell       *G.Node
+	output     *G.Node
+	machine    G.VM
+}
+
+func (m *Model) newStepper() (*stepper, error) {
 	hiddenT := tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(m.hiddenSize))
 	cellT := tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(m.hiddenSize))
 	lstm := m.newLSTM(hiddenT, cellT)
@@ -55,36 +65,109 @@ func (m *Model) Predict(ctx context.Context, dataSet datasetter.Float32ReadWrite
 	prevHidden := G.NewVector(lstm.g, tensor.Float32, G.WithName("hₜ₋₁"), G.WithShape(m.hiddenSize), G.WithValue(hiddenT))
 	prevCell := G.NewVector(lstm.g, tensor.Float32, G.WithName("Cₜ₋₁"), G.WithShape(m.hiddenSize), G.WithValue(cellT))
 	// First pass to get update the hidden state and the cell according to the input
-	hidden, cell, err := lstm.forwardStep(dummySet, prevHidden, prevCell, 0)
+	hidden, cell, err := lstm.forwardStep(dummySet, prevHidden, prevCell)
+	if err != nil {
+		return nil, err
+	}
+	return &stepper{
+		input:      input,
+		prevHidden: prevHidden,
+		prevCell:   prevCell,
+		hidden:     hidden,
+		cell:       cell,
+		output:     dummySet.output,
+		machine:    G.NewTapeMachine(lstm.g),
+	}, nil
+}
+
+// step evaluates the graph for one input and carries the memory to the next step.
+// The returned output is only valid until the next call
+func (s *stepper) step(inputValue []float32) ([]float32, error) {
+	copy(s.input.Value().Data().([]float32), inputValue)
+	err := s.machine.RunAll()
+	if err != nil {
+		return nil, err
+	}
+	s.machine.Reset()
+	copy(s.prevHidden.Value().Data().([]float32), s.hidden.Value().Data().([]float32))
+	copy(s.prevCell.Value().Data().([]float32), s.cell.Value().Data().([]float32))
+	return s.output.Value().Data().([]float32), nil
+}
+
+// state returns a copy of the current hidden and cell states
+func (s *stepper) state() (hidden, cell []float32) {
+	hidden = make([]float32, s.prevHidden.Shape().TotalSize())
+	cell = make([]float32, s.prevCell.Shape().TotalSize())
+	copy(hidden, s.prevHidden.Value().Data().([]float32))
+	copy(cell, s.prevCell.Value().Data().([]float32))
+	return hidden, cell
+}
+
+// setState restores the hidden and cell states
+func (s *stepper) setState(hidden, cell []float32) {
+	copy(s.prevHidden.Value().Data().([]float32), hidden)
+	copy(s.prevCell.Value().Data().([]float32), cell)
+}
+
+// Predict feeds the prompt of the dataSet to the model, then generates tokens:
+// every sampled token becomes the next input, until the dataSet ends the generation.
+// The hidden and cell states are carried through the prompt and the whole generation
+func (m *Model) Predict(ctx context.Context, dataSet datasetter.Float32ReadWriter) error {
+	stepper, err := m.newStepper()
 	if err != nil {
 		return err
 	}
-	//g := lstm.g.SubgraphRoots(dataSet.GetComputedVectors()...)
-	//machine := G.NewTapeMachine(g, G.ExecuteFwdOnly())
-	machine := G.NewTapeMachine(lstm.g)
 
 	prompt := dataSet.(*Prediction).GetInput().String()
-    	parts := strings.Fields(prompt)
-
-	for _, r := range parts {
-		// fmt.Println(r)
+	parts := strings.Fields(prompt)
 
+	// Consume the prompt; only the prediction following its last token is kept
+	for i, r := range parts {
 		inputValue, err := dataSet.Read(r)
-		copy(input.Value().Data().([]float32), inputValue)
 		if err == io.EOF {
 			return nil
 		}
 		if err != nil {
 			return err
 		}
-		err = machine.RunAll()
+		output, err := stepper.step(inputValue)
 		if err != nil {
 			return err
 		}
-		machine.Reset()
-		dataSet.Write(dummySet.output.Value().Data().([]float32))
-		copy(prevHidden.Value().Data().([]float32), hidden.Value().Data().([]float32))
-		copy(prevCell.Value().Data().([]float32), cell.Value().Data().([]float32))
+		if i == len(parts)-1 {
+			if err := dataSet.Write(output); err != nil {
+				return err
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+
+	// Generation: the sampled token becomes the next input until the dataset stops it
+	generator, ok := dataSet.(datasetter.Float32Generator)
+	if !ok {
+		return nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		inputValue, err := generator.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		output, err := stepper.step(inputValue)
+		if err != nil {
+			return err
+		}
+		if err := dataSet.Write(output); err != nil {
+			return err
+		}
 	}
-	return nil
 }
@@ -0,0 +1,53 @@
+package lstm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/owulveryck/lstm/datasetter/char"
+)
+
+func testVocab(tokens ...string) func(string) (int, error) {
+	return func(tk string) (int, error) {
+		for i, t := range tokens {
+			if t == tk {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("%v is not part of the vocabulary", tk)
+	}
+}
+
+func TestPredictGeneration(t *testing.T) {
+	tokens := []string{"\n", "a", "b", "c", "d"}
+	runeToIdx := testVocab(tokens...)
+	model := newModelFromBackends(testBackends(len(tokens), len(tokens), 10))
+	// favor "c" whatever the input
+	model.biasY[3] = 10
+
+	sampleSize := 7
+	prediction := char.NewPrediction("a b", runeToIdx, sampleSize, len(tokens))
+	if err := model.Predict(context.TODO(), prediction); err != nil {
+		t.Fatal(err)
+	}
+	if len(prediction.GetOutput()) != sampleSize {
+		t.Fatalf("expected %v generated tokens, got %v", sampleSize, len(prediction.GetOutput()))
+	}
+	for _, output := range prediction.GetOutput() {
+		if output[3] != 1 {
+			t.Fatalf("expected c, got %v", output)
+		}
+	}
+
+	// favor the newline: the generation must stop right away
+	model.biasY[3] = 0
+	model.biasY[0] = 10
+	prediction = char.NewPrediction("a b", runeToIdx, sampleSize, len(tokens))
+	if err := model.Predict(context.TODO(), prediction); err != nil {
+		t.Fatal(err)
+	}
+	if len(prediction.GetOutput()) != 0 {
+		t.Fatalf("the generation should stop on a newline, got %v tokens", len(prediction.GetOutput()))
+	}
+}
@@ -3,7 +3,8 @@ package lstm
 import (
 	"context"
 	"errors"
-	"sync"
+	"fmt"
+	"math"
 
 	"github.com/owulveryck/lstm/datasetter"
 	G "gorgonia.org/gorgonia"
@@ -12,7 +13,7 @@ import (
 
 // the cost function
 func (l *lstm) cost(dataSet datasetter.Trainer) (cost, perplexity, hidden, cell *G.Node, err error) {
-	hidden, cell, err = l.forwardStep(dataSet, l.prevHidden, l.prevCell, 0)
+	hidden, cell, err = l.forwardStep(dataSet, l.prevHidden, l.prevCell)
 	if err != nil {
 		return nil, nil, nil, nil, err
 	}
@@ -23,6 +24,9 @@ func (l *lstm) cost(dataSet datasetter.Trainer) (cost, perplexity, hidden, cell
 		if err != nil {
 			return nil, nil, nil, nil, err
 		}
+		if expectedValue == datasetter.Ignore {
+			continue
+		}
 		logprob := G.Must(G.Neg(G.Must(G.Log(computedVector))))
 		loss = G.Must(G.Slice(logprob, G.S(expectedValue)))
 		log2prob := G.Must(G.Neg(G.Must(G.Log2(computedVector))))
@@ -41,6 +45,9 @@ func (l *lstm) cost(dataSet datasetter.Trainer) (cost, perplexity, hidden, cell
 			perplexity = G.Must(G.Add(perplexity, perp))
 		}
 	}
+	if cost == nil {
+		return nil, nil, nil, nil, errors.New("no expected value to learn")
+	}
 	//l.prevHidden = hidden
 	//l.prevCell = cell
 	//g := l.g.SubgraphRoots(cost, perplexity)
@@ -50,89 +57,450 @@ func (l *lstm) cost(dataSet datasetter.Trainer) (cost, perplexity, hidden, cell
 
 // TrainingInfos returns info about the current training process
 type TrainingInfos struct {
-	Step       int
+	Step  int
+	Epoch int
+	// Perplexity is the Cost in bits: the perplexity of the step is e^Cost
 	Perplexity float32
-	Cost       float32
+	// Cost is the mean loss of the tokens learned in this step, in nats
+	Cost float32
+	// LearnRate is the learn rate of the solver at this step, it is zero if the solver has none
+	LearnRate float64
+	// Gradients holds the norms of the gradients of this step if the solver reports them,
+	// such as a G.GlobalNormClipper
+	Gradients G.GradStats
+	// Tokens is the number of tokens whose loss has been learned in this step
+	Tokens int
+	// Validated is true if the model has been evaluated on the validation set after this step.
+	// The infos of a validated step are always sent
+	Validated bool
+	// ValidationLoss is the mean loss of the model on the validation set, in nats
+	ValidationLoss float32
+	// ValidationPerplexity is e^ValidationLoss
+	ValidationPerplexity float32
+	// Best is true if the validation loss is the lowest one of the training
+	Best bool
+	// State is what is needed to resume the training after this step
+	State TrainingState
+	// Interrupted is true for the infos given once the context of the training is cancelled.
+	// They repeat the infos of the last step and are always sent; the training then stops
+	// without modifying the model, the solver or the dataset anymore
+	Interrupted bool
+}
+
+// TrainingState is the position of a training. Along with the weights, the state of the solver
+// and the position of the dataset, it is enough to resume the training where it stopped
+type TrainingState struct {
+	Step  int
+	Epoch int
+	// BestLoss is the lowest validation loss, it is negative before the first evaluation.
+	// Stale is the number of evaluations since it has been reached
+	BestLoss float32
+	Stale    int
+	// Hidden and Cell hold the memory carried to the next step
+	Hidden []float32
+	Cell   []float32
+}
+
+// ErrEarlyStop is returned by Train when the validation loss has stopped decreasing
+var ErrEarlyStop = errors.New("the validation loss is not decreasing anymore")
+
+// TrainOpt is an option of the training
+type TrainOpt func(o *trainOptions)
+
+type trainOptions struct {
+	batchSize   int
+	epochs      int
+	statePolicy StatePolicy
+	eos         []int
+
+	validation    func() (datasetter.FullTrainer, error)
+	validateEvery int
+	patience      int
+
+	resume *TrainingState
+
+	checkpointEvery int
+
+	dropout Dropout
+}
+
+// StatePolicy tells what memory a training step starts with
+type StatePolicy int
+
+const (
+	// ResetState starts every step with a zero memory: the sequences are independent samples
+	ResetState StatePolicy = iota
+	// CarryState starts a step with the final memory of the previous one: the sequences are the
+	// contiguous chunks of a stream trained with truncated backpropagation through time.
+	// Every sequence must continue the one of the previous step, as a char.TrainingSet read by batches of 1,
+	// without shuffling nor pair alignment and with a stride of its window minus one: the last token of a
+	// window, which is only expected, is then the first input of the next one
+	CarryState
+	// ResetAtEOS carries the memory but resets it after every position expecting an end of sequence token.
+	// The dataset must implement datasetter.IndexTrainer or datasetter.BatchTrainer
+	ResetAtEOS
+)
+
+func (p StatePolicy) String() string {
+	switch p {
+	case ResetState:
+		return "reset"
+	case CarryState:
+		return "carry"
+	case ResetAtEOS:
+		return "eos"
+	}
+	return fmt.Sprintf("StatePolicy(%d)", int(p))
+}
+
+// WithStatePolicy sets what memory a training step starts with. The default is ResetState.
+// eos holds the indices of the end of sequence tokens used by ResetAtEOS
+func WithStatePolicy(p StatePolicy, eos ...int) TrainOpt {
+	return func(o *trainOptions) {
+		o.statePolicy = p
+		o.eos = eos
+	}
+}
+
+// WithBatchSize trains on batches of n sequences. The cost of a step is the mean of the
+// loss of the tokens of the batch. When n > 1 the dataset must implement datasetter.BatchTrainer
+func WithBatchSize(n int) TrainOpt {
+	return func(o *trainOptions) {
+		o.batchSize = n
+	}
+}
+
+// WithEpochs reads the dataset n times. The dataset must implement datasetter.Rewinder when n > 1
+func WithEpochs(n int) TrainOpt {
+	return func(o *trainOptions) {
+		o.epochs = n
+	}
+}
+
+// WithValidation evaluates the model every n steps on the dataset returned by newSet.
+// The training stops with ErrEarlyStop once patience evaluations in a row have not improved
+// the lowest validation loss; a patience of zero never stops the training.
+// A solver implementing G.Observer, such as a G.Scheduler, is told every validation loss
+func WithValidation(newSet func() (datasetter.FullTrainer, error), n, patience int) TrainOpt {
+	return func(o *trainOptions) {
+		o.validation = newSet
+		o.validateEvery = n
+		o.patience = patience
+	}
+}
+
+// WithResume continues the training from state: the steps and the epochs are counted from the ones
+// of state and the memory is restored. The dataset must already be positioned where state has been taken
+func WithResume(state TrainingState) TrainOpt {
+	return func(o *trainOptions) {
+		o.resume = &state
+	}
+}
+
+// WithCheckpointEvery calls the OnCheckpoint hooks of a Trainer every n steps
+func WithCheckpointEvery(n int) TrainOpt {
+	return func(o *trainOptions) {
+		o.checkpointEvery = n
+	}
 }
 
-// Train the model
-func (m *Model) Train(ctx context.Context, dset datasetter.FullTrainer, solver G.Solver, pauseChan <-chan struct{}) (<-chan TrainingInfos, <-chan error) {
+// Train the model in a goroutine sending the infos of the steps. The infos channel is closed when the
+// training ends and must be read until then. Once ctx is cancelled, the current step finishes and the
+// training stops with a nil error.
+// A value received on pauseChan pauses the training between two steps: the infos of the last step,
+// holding the State to resume the training from, are then sent and must be read before the next value
+// received on pauseChan resumes the training. A Trainer runs hooks between the steps without this protocol
+func (m *Model) Train(ctx context.Context, dset datasetter.FullTrainer, solver G.Solver, pauseChan <-chan struct{}, opts ...TrainOpt) (<-chan TrainingInfos, <-chan error) {
 	infoChan := make(chan TrainingInfos, 0)
-	step := 0
 	errc := make(chan error, 1)
-	var wg sync.WaitGroup
-	wg.Add(1)
-	paused := false
-
-	go func() {
-		if len(pauseChan) != 0 {
-			errc <- errors.New("pauseChan must not be buffered")
-			wg.Done()
-			return
-		}
-		var hiddenT, cellT tensor.Tensor
-		for {
+	t := NewTrainer(m, solver, opts...)
+	t.OnStep(func(infos TrainingInfos) error {
+		if infos.Validated {
 			select {
+			case infoChan <- infos:
 			case <-ctx.Done():
-				errc <- nil
-				wg.Done()
-				return
-			case <-pauseChan:
-				paused = true
+			}
+		} else {
+			// send infos about this execution step in a non blocking channel
+			select {
+			case infoChan <- infos:
 			default:
-				if paused {
-					<-pauseChan
-					paused = false
-				}
-				step++
-				if hiddenT == nil {
-					hiddenT = tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(m.hiddenSize))
-				}
-				if cellT == nil {
-					cellT = tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(m.hiddenSize))
-				}
-				lstm := m.newLSTM(hiddenT, cellT)
-				trainer, err := dset.GetTrainer()
-				if err != nil {
-					errc <- err
-					wg.Done()
-					return
-				}
-				cost, perplexity, hidden, cell, err := lstm.cost(trainer)
-				if err != nil {
-					errc <- err
-					wg.Done()
-					return
-				}
-				machine := G.NewLispMachine(lstm.g)
-				if err := machine.RunAll(); err != nil {
-					errc <- err
-					wg.Done()
-					return
-				}
-				// send infos about this execution step in a non blocking channel
-				select {
-				case infoChan <- TrainingInfos{
-					Perplexity: perplexity.Value().Data().(float32),
-					Cost:       cost.Value().Data().(float32),
-					Step:       step,
-				}:
-				default:
-				}
-				copy(hiddenT.Data().([]float32), hidden.Value().Data().([]float32))
-				copy(cellT.Data().([]float32), cell.Value().Data().([]float32))
-				// solver.Step(G.Nodes{
-				solver.Step(G.NodesToValueGrads(G.Nodes{
-					lstm.biasC, lstm.biasF, lstm.biasI, lstm.biasO, lstm.biasY,
-					lstm.uc, lstm.uf, lstm.ui, lstm.uo,
-					// lstm.wc, lstm.wf, lstm.wi, lstm.wo, lstm.wy})
-					lstm.wc, lstm.wf, lstm.wi, lstm.wo, lstm.wy}))
 			}
 		}
-	}()
+		select {
+		case <-pauseChan:
+			infoChan <- infos
+			select {
+			case <-pauseChan:
+			case <-ctx.Done():
+			}
+		default:
+		}
+		return nil
+	})
+	t.OnCheckpoint(func(infos TrainingInfos) error {
+		if infos.Interrupted {
+			infoChan <- infos
+		}
+		return nil
+	})
+
 	go func() {
-		wg.Wait()
-		close(infoChan)
+		defer close(infoChan)
+		if len(pauseChan) != 0 {
+			errc <- errors.New("pauseChan must not be buffered")
+			return
+		}
+		_, err := t.Run(ctx, dset)
+		errc <- err
 	}()
 	return infoChan, errc
 }
+
+// trainSession holds what a training keeps from a step to the next one
+type trainSession struct {
+	m        *Model
+	dset     datasetter.FullTrainer
+	batcher  datasetter.BatchTrainer
+	rewinder datasetter.Rewinder
+	epoch    int
+	solver   G.Solver
+	options  trainOptions
+	cache    *graphCache
+	// the memory holds one row per sequence of the batch
+	hiddenT tensor.Tensor
+	cellT   tensor.Tensor
+	// tokens is the number of tokens learned by the last step
+	tokens int
+}
+
+func (m *Model) newTrainSession(dset datasetter.FullTrainer, solver G.Solver, options trainOptions) (*trainSession, error) {
+	s := &trainSession{
+		m:       m,
+		dset:    dset,
+		solver:  solver,
+		options: options,
+	}
+	if options.batchSize > 1 {
+		batcher, ok := dset.(datasetter.BatchTrainer)
+		if !ok {
+			return nil, errors.New("the dataset cannot be read by batches")
+		}
+		s.batcher = batcher
+	}
+	if options.epochs > 1 {
+		rewinder, ok := dset.(datasetter.Rewinder)
+		if !ok {
+			return nil, errors.New("the dataset cannot be read several times")
+		}
+		s.rewinder = rewinder
+	}
+	switch options.statePolicy {
+	case ResetState, CarryState:
+		s.cache = newGraphCache()
+	case ResetAtEOS:
+		if len(options.eos) == 0 {
+			return nil, errors.New("no end of sequence token to reset the memory at")
+		}
+		s.cache = newGraphCache(options.eos...)
+	default:
+		return nil, fmt.Errorf("unknown state policy %v", options.statePolicy)
+	}
+	if err := options.dropout.validate(); err != nil {
+		return nil, err
+	}
+	s.cache.dropout = options.dropout
+	memoryShape := tensor.Shape{m.hiddenSize}
+	if options.batchSize > 1 {
+		memoryShape = tensor.Shape{options.batchSize, m.hiddenSize}
+	}
+	s.hiddenT = tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(memoryShape...))
+	s.cellT = tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(memoryShape...))
+	if options.resume != nil {
+		hidden, cell := s.hiddenT.Data().([]float32), s.cellT.Data().([]float32)
+		if len(options.resume.Hidden) != len(hidden) || len(options.resume.Cell) != len(cell) {
+			return nil, errors.New("the memory of the resumed training does not match the batch size")
+		}
+		copy(hidden, options.resume.Hidden)
+		copy(cell, options.resume.Cell)
+		s.epoch = options.resume.Epoch
+	}
+	return s, nil
+}
+
+// state returns the position of the training after step
+func (s *trainSession) state(step int, bestLoss float32, stale int) TrainingState {
+	return TrainingState{
+		Step:     step,
+		Epoch:    s.epoch,
+		BestLoss: bestLoss,
+		Stale:    stale,
+		Hidden:   append([]float32(nil), s.hiddenT.Data().([]float32)...),
+		Cell:     append([]float32(nil), s.cellT.Data().([]float32)...),
+	}
+}
+
+// step trains the model on the next sequence or batch of the dataset, as the step number n of the training.
+// It returns io.EOF at the end of the dataset
+func (s *trainSession) step(n int) (cost, perplexity float32, err error) {
+	if s.options.statePolicy == ResetState {
+		s.hiddenT.Zero()
+		s.cellT.Zero()
+	}
+	if s.options.dropout.enabled() {
+		s.cache.masks = dropoutSource(s.m.seed, n)
+	}
+	if s.batcher != nil {
+		batch, err := s.batcher.GetBatch(s.options.batchSize)
+		if err != nil {
+			return 0, 0, err
+		}
+		s.tokens = 0
+		for _, v := range batch.Mask.Data().([]float32) {
+			s.tokens += int(v)
+		}
+		return s.m.trainBatch(batch, s.solver, s.cache, s.hiddenT, s.cellT)
+	}
+	trainer, err := s.dset.GetTrainer()
+	if err != nil {
+		return 0, 0, err
+	}
+	cost, perplexity, err = s.m.trainStep(trainer, s.solver, s.cache, s.hiddenT, s.cellT)
+	s.tokens = learnedTokens(trainer)
+	return cost, perplexity, err
+}
+
+// learnedTokens returns the number of expected values of trainer that are not ignored
+func learnedTokens(trainer datasetter.Trainer) int {
+	n := len(trainer.GetComputedVectors())
+	if it, ok := trainer.(datasetter.IndexTrainer); ok {
+		n = it.Len()
+	}
+	tokens := 0
+	for i := 0; i < n; i++ {
+		if expected, err := trainer.GetExpectedValue(i); err == nil && expected != datasetter.Ignore {
+			tokens++
+		}
+	}
+	return tokens
+}
+
+// nextEpoch rewinds the dataset and resets the memory. It returns false once every epoch is read
+func (s *trainSession) nextEpoch() bool {
+	if s.epoch+1 >= s.options.epochs {
+		return false
+	}
+	s.rewinder.Rewind()
+	s.epoch++
+	s.hiddenT.Zero()
+	s.cellT.Zero()
+	return true
+}
+
+// trainStep runs a forward and a backward pass on trainer and updates the weights.
+// The cost is the mean of the loss of the learned tokens, as the cost of a batch;
+// it is returned in nats and in bits (the perplexity field of TrainingInfos).
+// The final memory is copied into hiddenT and cellT.
+// A Trainer exposing its indices is bound to a graph compiled once per sequence length;
+// any other Trainer gets a graph built for this step only
+func (m *Model) trainStep(trainer datasetter.Trainer, solver G.Solver, cache *graphCache, hiddenT, cellT tensor.Tensor) (cost, perplexity float32, err error) {
+	if it, ok := trainer.(datasetter.IndexTrainer); ok && it.Len() > 0 {
+		batch, err := sequenceBatch(it)
+		if err != nil {
+			return 0, 0, err
+		}
+		return m.trainBatch(batch, solver, cache, hiddenT, cellT)
+	}
+
+	if cache != nil && cache.eos != nil {
+		return 0, 0, errors.New("the memory can only be reset at the end of the sequences of an IndexTrainer")
+	}
+	if cache != nil && cache.dropout.enabled() {
+		return 0, 0, errors.New("the units can only be dropped from the sequences of an IndexTrainer")
+	}
+	lstm := m.newLSTM(hiddenT, cellT)
+	costNode, _, hidden, cell, err := lstm.cost(trainer)
+	if err != nil {
+		return 0, 0, err
+	}
+	costNode = G.Must(G.Mul(costNode, G.NewConstant(1/float32(learnedTokens(trainer)))))
+	learnables := lstm.learnables()
+	if _, err := G.Grad(costNode, learnables...); err != nil {
+		return 0, 0, err
+	}
+	machine := G.NewTapeMachine(lstm.g, G.BindDualValues(learnables...))
+	if err := machine.RunAll(); err != nil {
+		return 0, 0, err
+	}
+	copy(hiddenT.Data().([]float32), hidden.Value().Data().([]float32))
+	copy(cellT.Data().([]float32), cell.Value().Data().([]float32))
+	cost = costNode.Value().Data().(float32)
+	return cost, cost / math.Ln2, solver.Step(G.NodesToValueGrads(learnables))
+}
+
+// trainBatch runs a forward and a backward pass on a batch and updates the weights.
+// The cost is the mean of the loss of the unmasked tokens.
+// hiddenT and cellT hold the (B × hiddenSize) memory of the rows of the batch
+func (m *Model) trainBatch(batch *datasetter.Batch, solver G.Solver, cache *graphCache, hiddenT, cellT tensor.Tensor) (cost, perplexity float32, err error) {
+	var tokens float32
+	for _, v := range batch.Mask.Data().([]float32) {
+		tokens += v
+	}
+	if tokens == 0 {
+		return 0, 0, errors.New("empty batch")
+	}
+	return m.runCompiled(batch, 1/tokens, solver, cache, hiddenT, cellT)
+}
+
+// runCompiled binds batch to the graph compiled for its shape, creating it if needed, and runs it
+func (m *Model) runCompiled(batch *datasetter.Batch, scale float32, solver G.Solver, cache *graphCache, hiddenT, cellT tensor.Tensor) (cost, perplexity float32, err error) {
+	shape := batch.Inputs.Shape()
+	key := batchShape{size: shape[0], seqLen: shape[1]}
+	if hiddenT.Shape().TotalSize() != key.size*m.hiddenSize || cellT.Shape().TotalSize() != key.size*m.hiddenSize {
+		return 0, 0, errors.New("the memory does not match the batch size")
+	}
+	c, ok := cache.graphs[key]
+	if !ok {
+		if c, err = m.compile(key.size, key.seqLen, cache.eos != nil, cache.dropout); err != nil {
+			return 0, 0, err
+		}
+		cache.graphs[key] = c
+	}
+	hidden, cell := hiddenT.Data().([]float32), cellT.Data().([]float32)
+	if err = c.bind(batch, scale, hidden, cell, cache.eos, cache.masks); err != nil {
+		return 0, 0, err
+	}
+	// the values are read before the solver step resets the tape
+	err = c.run(func() {
+		cost = c.cost.Value().Data().(float32)
+		copy(hidden, c.hidden.Value().Data().([]float32))
+		copy(cell, c.cell.Value().Data().([]float32))
+	}, solver)
+	if err != nil || cache.eos == nil {
+		return cost, cost / math.Ln2, err
+	}
+	// the memory of the sequences whose last position expects an end of sequence is reset
+	targets := batch.Targets.Data().([]int)
+	mask := batch.Mask.Data().([]float32)
+	for b := 0; b < key.size; b++ {
+		for i := key.seqLen - 1; i >= 0; i-- {
+			offset := b*key.seqLen + i
+			if mask[offset] == 0 {
+				continue
+			}
+			if cache.eos[targets[offset]] {
+				resetRow(hidden, b, m.hiddenSize)
+				resetRow(cell, b, m.hiddenSize)
+			}
+			break
+		}
+	}
+	return cost, cost / math.Ln2, nil
+}
+
+// resetRow sets the row of a (B × size) memory to zero
+func resetRow(memory []float32, row, size int) {
+	for i := row * size; i < (row+1)*size; i++ {
+		memory[i] = 0
+	}
+}
@@ -1,10 +1,17 @@
 package lstm
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"io"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/owulveryck/lstm/datasetter"
+	"github.com/owulveryck/lstm/datasetter/char"
 	G "gorgonia.org/gorgonia"
 	"gorgonia.org/tensor"
 )
@@ -53,9 +60,9 @@ func TestCost(t *testing.T) {
 		if err := machine.RunAll(); err != nil {
 			t.Fatalf("Pass: %v, error: %v", i, err)
 		}
-		solver.Step(G.Nodes{l.biasC, l.biasF, l.biasI, l.biasO, l.biasY,
+		solver.Step(G.NodesToValueGrads(G.Nodes{l.biasC, l.biasF, l.biasI, l.biasO, l.biasY,
 			l.uc, l.uf, l.ui, l.uo,
-			l.wc, l.wf, l.wi, l.wo, l.wy})
+			l.wc, l.wf, l.wi, l.wo, l.wy}))
 		copy(hiddenT.Data().([]float32), hidden.Value().Data().([]float32))
 		copy(cellT.Data().([]float32), cell.Value().Data().([]float32))
 		tset.flush()
@@ -105,6 +112,9 @@ func TestTrain(t *testing.T) {
 	for infos := range infoChan {
 		t.Log(infos)
 		for _, computedVector := range tset.GetComputedVectors() {
+			if computedVector.Value() == nil {
+				continue
+			}
 			t.Log(computedVector.Value().Data().([]float32))
 		}
 	}
@@ -118,3 +128,467 @@ func TestTrain(t *testing.T) {
 	}
 
 }
+
+// sequenceSet returns the same sequence at every call of GetTrainer
+type sequenceSet struct {
+	inputs  []int
+	targets []int
+}
+
+func (s sequenceSet) GetTrainer() (datasetter.Trainer, error) {
+	set := &testSet{
+		values:         make([][]float32, len(s.inputs)),
+		expectedValues: s.targets,
+	}
+	for i, idx := range s.inputs {
+		set.values[i] = make([]float32, 5)
+		set.values[i][idx] = 1
+	}
+	return indexSet{set}, nil
+}
+
+// observingSolver records the losses it is told
+type observingSolver struct {
+	*G.VanillaSolver
+	losses []float64
+}
+
+func (s *observingSolver) Observe(loss float64) {
+	s.losses = append(s.losses, loss)
+}
+
+func TestLearnRateSchedule(t *testing.T) {
+	m := newModelFromBackends(testBackends(5, 5, 4))
+	sequence := sequenceSet{inputs: []int{0, 1, 2, 3}, targets: []int{1, 2, 3, 4}}
+	validation := func() (datasetter.FullTrainer, error) {
+		return &finiteSet{sequenceSet: sequence, count: 1}, nil
+	}
+	scheduler, err := G.NewScheduler(G.NewVanillaSolver(G.WithLearnRate(1e-3)), G.NewExponentialDecay(0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the infos of every step are validated, so none is dropped
+	infoChan, errc := m.Train(context.Background(), &finiteSet{sequenceSet: sequence, count: 4}, scheduler, make(chan struct{}), WithValidation(validation, 1, 0))
+	rate := 1e-3
+	for infos := range infoChan {
+		if math.Abs(infos.LearnRate-rate) > 1e-15 {
+			t.Fatalf("step %v: expected the learn rate %v, got %v", infos.Step, rate, infos.LearnRate)
+		}
+		rate /= 2
+	}
+	if err := <-errc; err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+
+	solver := &observingSolver{VanillaSolver: G.NewVanillaSolver(G.WithLearnRate(0))}
+	infoChan, errc = m.Train(context.Background(), sequence, solver, make(chan struct{}), WithValidation(validation, 2, 2))
+	var losses []float64
+	for infos := range infoChan {
+		if infos.Validated {
+			losses = append(losses, float64(infos.ValidationLoss))
+		}
+	}
+	if err := <-errc; err != ErrEarlyStop {
+		t.Fatalf("expected ErrEarlyStop, got %v", err)
+	}
+	if len(losses) != 3 || len(solver.losses) != 3 {
+		t.Fatalf("expected 3 validation losses, got %v, the solver got %v", losses, solver.losses)
+	}
+	for i := range losses {
+		if losses[i] != solver.losses[i] {
+			t.Fatalf("the solver should observe the validation losses %v, got %v", losses, solver.losses)
+		}
+	}
+}
+
+func TestGradientStats(t *testing.T) {
+	m := newModelFromBackends(testBackends(5, 5, 4))
+	sequence := sequenceSet{inputs: []int{0, 1, 2, 3}, targets: []int{1, 2, 3, 4}}
+	validation := func() (datasetter.FullTrainer, error) {
+		return &finiteSet{sequenceSet: sequence, count: 1}, nil
+	}
+	clipper := G.NewGlobalNormClipper(G.NewVanillaSolver(G.WithLearnRate(0.1)), 1e-3)
+	infoChan, errc := m.Train(context.Background(), &finiteSet{sequenceSet: sequence, count: 2}, clipper, make(chan struct{}), WithValidation(validation, 1, 0))
+	steps := 0
+	for infos := range infoChan {
+		steps++
+		stats := infos.Gradients
+		if len(stats.Norms) != 14 {
+			t.Fatalf("expected the norms of the 14 weights and biases, got %v", stats.Norms)
+		}
+		var sum float64
+		for _, norm := range stats.Norms {
+			sum += norm * norm
+		}
+		if math.Abs(math.Sqrt(sum)-stats.GlobalNorm) > 1e-9 || !stats.Clipped {
+			t.Fatalf("bad gradient stats %+v", stats)
+		}
+	}
+	if err := <-errc; err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if steps != 2 {
+		t.Fatalf("expected 2 steps, got %v", steps)
+	}
+}
+
+func TestStatePolicy(t *testing.T) {
+	hiddenSize := 4
+	back := testBackends(5, 5, hiddenSize)
+	back.Wy = G.Gaussian32(0, 1, 5, hiddenSize)
+	back.Wi = G.Gaussian32(0, 1, hiddenSize, 5)
+	back.Ui = G.Gaussian32(0, 1, hiddenSize, hiddenSize)
+	back.Wc = G.Gaussian32(0, 1, hiddenSize, 5)
+	// costs trains twice on dset without updating the weights
+	costs := func(dset datasetter.FullTrainer, opts ...TrainOpt) (float32, float32) {
+		options := trainOptions{batchSize: 1}
+		for _, opt := range opts {
+			opt(&options)
+		}
+		session, err := newModelFromBackends(cloneBackends(back)).newTrainSession(dset, G.NewVanillaSolver(G.WithLearnRate(0)), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, _, err := session.step(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, _, err := session.step(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return first, second
+	}
+	same := func(a, b float32) bool {
+		return math.Abs(float64(a-b)) < 1e-5
+	}
+	dset := sequenceSet{inputs: []int{0, 1, 2, 3, 4}, targets: []int{1, 2, 3, 4, 0}}
+
+	t.Run("carry", func(t *testing.T) {
+		first, second := costs(dset, WithStatePolicy(CarryState))
+		if same(first, second) {
+			t.Fatal("the second step should start with the memory of the first one")
+		}
+	})
+	t.Run("reset", func(t *testing.T) {
+		first, second := costs(dset, WithStatePolicy(ResetState))
+		if !same(first, second) {
+			t.Fatalf("every step should start with a zero memory: %v/%v", first, second)
+		}
+		if first, second := costs(dset); !same(first, second) {
+			t.Fatalf("the memory should be reset by default: %v/%v", first, second)
+		}
+	})
+	t.Run("eos", func(t *testing.T) {
+		// the sequence ends with an end of sequence token, the next one starts with a zero memory
+		first, second := costs(dset, WithStatePolicy(ResetAtEOS, 0))
+		if !same(first, second) {
+			t.Fatalf("the memory should be reset at the end of the sequence: %v/%v", first, second)
+		}
+		// 2 is expected in the middle of the sequence: what follows is trained as a new sequence
+		head, _ := costs(sequenceSet{inputs: []int{0, 1, 2, 3, 4}, targets: []int{1, 2, datasetter.Ignore, datasetter.Ignore, datasetter.Ignore}})
+		tail, _ := costs(sequenceSet{inputs: []int{2, 3, 4}, targets: []int{3, 4, 0}})
+		// the costs are the means of the loss of the 2 tokens of the head, the 3 of the tail and the 5 of dset
+		whole := (2*head + 3*tail) / 5
+		reset, _ := costs(dset, WithStatePolicy(ResetAtEOS, 2))
+		if !same(reset, whole) {
+			t.Fatalf("the memory should be reset after the end of sequence: %v/%v", reset, whole)
+		}
+		carried, _ := costs(dset)
+		if same(carried, whole) {
+			t.Fatal("the memory should only be reset with ResetAtEOS")
+		}
+	})
+}
+
+// newShuffledSet returns a small training set shuffled with seed
+func newShuffledSet(seed int64) *char.TrainingSet {
+	return newCharSet("a b c d a\nb c a d b c\n", 3, 2, char.WithShuffle(seed))
+}
+
+// newCharSet returns a training set of text, read by windows of size tokens sliding by step tokens
+func newCharSet(text string, size, step int, opts ...char.TrainingSetOpt) *char.TrainingSet {
+	tokens := map[string]int{"\n": 0, "a": 1, "b": 2, "c": 3, "d": 4}
+	runeToIdx := func(r string) (int, error) {
+		idx, ok := tokens[r]
+		if !ok {
+			return 0, errors.New("unknown token")
+		}
+		return idx, nil
+	}
+	idxToRune := func(i int) (string, error) {
+		for tk, idx := range tokens {
+			if idx == i {
+				return tk, nil
+			}
+		}
+		return "", errors.New("unknown index")
+	}
+	return char.NewTrainingSet(strings.NewReader(text), runeToIdx, idxToRune, 5, size, step, opts...)
+}
+
+func modelWeights(t *testing.T, m *Model) []byte {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// savedTraining is what a caller saves to resume an interrupted training
+type savedTraining struct {
+	weights       []byte
+	solver        G.SolverState
+	epoch, offset int
+	state         TrainingState
+}
+
+// testResumedTraining trains a model for 3 epochs, then trains it again from the same weights until
+// interrupt stops the training and returns what a caller would save: the training resumed from it
+// must end with the weights of the uninterrupted one
+func testResumedTraining(t *testing.T, interrupt func(m *Model, tset *char.TrainingSet, solver *G.AdamSolver) savedTraining) {
+	initial := newModelFromBackends(testBackends(5, 5, 4))
+	start := modelWeights(t, initial)
+	infoChan, errc := initial.Train(context.Background(), newShuffledSet(7), G.NewAdamSolver(), make(chan struct{}), WithEpochs(3))
+	for range infoChan {
+	}
+	if err := <-errc; err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	expected := modelWeights(t, initial)
+
+	var m Model
+	if err := m.UnmarshalBinary(start); err != nil {
+		t.Fatal(err)
+	}
+	saved := interrupt(&m, newShuffledSet(7), G.NewAdamSolver())
+
+	var resumed Model
+	if err := resumed.UnmarshalBinary(saved.weights); err != nil {
+		t.Fatal(err)
+	}
+	solver := G.NewAdamSolver()
+	if err := solver.SetState(saved.solver); err != nil {
+		t.Fatal(err)
+	}
+	tset := newShuffledSet(7)
+	if err := tset.Seek(saved.epoch, saved.offset); err != nil {
+		t.Fatal(err)
+	}
+	infoChan, errc = resumed.Train(context.Background(), tset, solver, make(chan struct{}), WithEpochs(3), WithResume(saved.state))
+	steps := 0
+	for infos := range infoChan {
+		steps = infos.Step
+	}
+	if err := <-errc; err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if steps <= saved.state.Step {
+		t.Fatalf("the steps should be counted from the resumed one, got %v", steps)
+	}
+	if !bytes.Equal(modelWeights(t, &resumed), expected) {
+		t.Fatal("the resumed training should end with the weights of the uninterrupted one")
+	}
+}
+
+func TestResume(t *testing.T) {
+	// the training is saved by the validation after the fifth step, then cancelled
+	testResumedTraining(t, func(m *Model, tset *char.TrainingSet, solver *G.AdamSolver) (saved savedTraining) {
+		ctx, cancel := context.WithCancel(context.Background())
+		// the validation set is read by the training between two steps, when the state is consistent
+		validation := func() (datasetter.FullTrainer, error) {
+			// the training may go on until it sees the cancellation
+			if saved.weights == nil {
+				saved.weights = modelWeights(t, m)
+				var err error
+				if saved.solver, err = solver.State(); err != nil {
+					return nil, err
+				}
+				saved.epoch = tset.Epoch()
+				saved.offset, _ = tset.Position()
+			}
+			return &finiteSet{sequenceSet: sequenceSet{inputs: []int{1, 2}, targets: []int{2, 3}}, count: 1}, nil
+		}
+		infoChan, _ := m.Train(ctx, tset, solver, make(chan struct{}), WithEpochs(3), WithValidation(validation, 5, 0))
+		infos := <-infoChan
+		for !infos.Validated {
+			infos = <-infoChan
+		}
+		cancel()
+		for range infoChan {
+		}
+		if infos.State.Step != 5 || len(saved.solver.Params) != 14 || saved.solver.Iter != 5 {
+			t.Fatalf("bad state at step %v: %v parameters after %v steps", infos.State.Step, len(saved.solver.Params), saved.solver.Iter)
+		}
+		saved.state = infos.State
+		return saved
+	})
+}
+
+func TestInterrupt(t *testing.T) {
+	// the training is cancelled between two steps, by the validation that the training runs itself
+	testResumedTraining(t, func(m *Model, tset *char.TrainingSet, solver *G.AdamSolver) savedTraining {
+		ctx, cancel := context.WithCancel(context.Background())
+		validation := func() (datasetter.FullTrainer, error) {
+			cancel()
+			return &finiteSet{sequenceSet: sequenceSet{inputs: []int{1, 2}, targets: []int{2, 3}}, count: 1}, nil
+		}
+		infoChan, errc := m.Train(ctx, tset, solver, make(chan struct{}), WithEpochs(3), WithValidation(validation, 5, 0))
+		var final TrainingInfos
+		for infos := range infoChan {
+			if final.Interrupted {
+				t.Fatal("the interrupted infos should be the last ones")
+			}
+			final = infos
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("an interrupted training should end without error, got %v", err)
+		}
+		if !final.Interrupted || final.Validated || final.Step != 5 || final.State.Step != 5 {
+			t.Fatalf("bad final infos %+v", final)
+		}
+
+		// the training has stopped, its state is the one of the final infos
+		solverState, err := solver.State()
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset, _ := tset.Position()
+		return savedTraining{weights: modelWeights(t, m), solver: solverState, epoch: tset.Epoch(), offset: offset, state: final.State}
+	})
+}
+
+func TestSolverStateAcrossGraphs(t *testing.T) {
+	// the pairs are shorter than the window, so the training compiles a graph for each of their lengths
+	newSet := func() *char.TrainingSet {
+		return newCharSet("a b\n\nc d a b c\n\nd a c\n", 4, 2, char.WithPairs())
+	}
+	initial := newModelFromBackends(testBackends(5, 5, 4))
+	solver := G.NewAdamW()
+	infoChan, errc := initial.Train(context.Background(), newSet(), solver, make(chan struct{}), WithEpochs(2))
+	for range infoChan {
+	}
+	if err := <-errc; err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	state, err := solver.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Params) != 14 {
+		t.Fatalf("expected the state of 14 parameters, got %v", len(state.Params))
+	}
+
+	// the training goes on with the same solver, and with a solver restored from its state
+	weights := modelWeights(t, initial)
+	resumed := G.NewAdamW()
+	if err := resumed.SetState(state); err != nil {
+		t.Fatal(err)
+	}
+	train := func(solver G.Solver) []byte {
+		var m Model
+		if err := m.UnmarshalBinary(weights); err != nil {
+			t.Fatal(err)
+		}
+		infoChan, errc := m.Train(context.Background(), newSet(), solver, make(chan struct{}))
+		for range infoChan {
+		}
+		if err := <-errc; err != io.EOF {
+			t.Fatalf("expected io.EOF, got %v", err)
+		}
+		return modelWeights(t, &m)
+	}
+	if !bytes.Equal(train(resumed), train(solver)) {
+		t.Fatal("the restored solver should update the weights as the original one")
+	}
+}
+
+// gatedSet returns its sequence once per value received on steps, then io.EOF once steps is closed
+type gatedSet struct {
+	sequenceSet
+	steps chan struct{}
+	read  int
+}
+
+func (s *gatedSet) GetTrainer() (datasetter.Trainer, error) {
+	if _, ok := <-s.steps; !ok {
+		return nil, io.EOF
+	}
+	s.read++
+	return s.sequenceSet.GetTrainer()
+}
+
+func TestPause(t *testing.T) {
+	m := newModelFromBackends(testBackends(5, 5, 4))
+	pause := make(chan struct{})
+	tset := &gatedSet{sequenceSet: sequenceSet{inputs: []int{1, 2, 3}, targets: []int{2, 3, 4}}, steps: make(chan struct{})}
+	infoChan, errc := m.Train(context.Background(), tset, G.NewAdamSolver(), pause)
+	// pauseAfter feeds the training until it is paused after a step following the step last
+	pauseAfter := func(last int) TrainingInfos {
+		for {
+			select {
+			case tset.steps <- struct{}{}:
+			case pause <- struct{}{}:
+				// the paused training sends the infos of the step it stopped after
+				if paused := <-infoChan; paused.Step > last {
+					return paused
+				}
+				pause <- struct{}{}
+			}
+		}
+	}
+	paused := pauseAfter(0)
+	if paused.State.Step != paused.Step || len(paused.State.Hidden) != 4 {
+		t.Fatalf("bad infos of the paused step %+v", paused)
+	}
+	if tset.read != paused.Step {
+		t.Fatalf("the dataset should be read up to the paused step, %v sequences read for %v steps", tset.read, paused.Step)
+	}
+	weights, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pause <- struct{}{}
+	pauseAfter(paused.Step)
+	if after, _ := m.MarshalBinary(); bytes.Equal(weights, after) {
+		t.Fatal("the weights should be trained after the pause")
+	}
+	pause <- struct{}{}
+	close(tset.steps)
+	for range infoChan {
+	}
+	if err := <-errc; err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestSeededTraining(t *testing.T) {
+	run := func(seed int64) ([]byte, G.SolverState) {
+		m := NewModel(5, 5, 4, WithSeed(seed))
+		tset := newShuffledSet(seed)
+		solver := G.NewAdamSolver()
+		if _, err := NewTrainer(m, solver, WithEpochs(2)).Run(context.Background(), tset); err != io.EOF {
+			t.Fatalf("expected io.EOF, got %v", err)
+		}
+		state, err := solver.State()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return modelWeights(t, m), state
+	}
+	first, firstState := run(42)
+	second, secondState := run(42)
+	if !bytes.Equal(first, second) || !reflect.DeepEqual(firstState, secondState) {
+		t.Fatal("two trainings with the same seed should end with the same weights and solver state")
+	}
+	if other, _ := run(43); bytes.Equal(first, other) {
+		t.Fatal("trainings with different seeds should differ")
+	}
+	var restored Model
+	if err := restored.UnmarshalBinary(first); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Seed() != 42 {
+		t.Fatalf("the seed should be saved with the model, got %v", restored.Seed())
+	}
+}
@@ -0,0 +1,192 @@
+package lstm
+
+import (
+	"context"
+	"io"
+
+	"github.com/owulveryck/lstm/datasetter"
+	G "gorgonia.org/gorgonia"
+)
+
+// Hook is called by a Trainer between two steps. The model, the solver and the dataset are not modified
+// while it runs, so it can read them, predict or save them. An error stops the training
+type Hook func(infos TrainingInfos) error
+
+// Trainer trains a model and runs hooks between the steps, on the goroutine running the training
+type Trainer struct {
+	model        *Model
+	solver       G.Solver
+	options      trainOptions
+	onStep       []Hook
+	onEpochEnd   []Hook
+	onEvaluate   []Hook
+	onCheckpoint []Hook
+}
+
+// NewTrainer returns a Trainer of the model
+func NewTrainer(m *Model, solver G.Solver, opts ...TrainOpt) *Trainer {
+	options := trainOptions{
+		batchSize: 1,
+		epochs:    1,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &Trainer{
+		model:   m,
+		solver:  solver,
+		options: options,
+	}
+}
+
+// OnStep registers hooks called after every step
+func (t *Trainer) OnStep(hooks ...Hook) {
+	t.onStep = append(t.onStep, hooks...)
+}
+
+// OnEpochEnd registers hooks called once the dataset has been read, before it is rewound.
+// They are given the infos of the last step of the epoch
+func (t *Trainer) OnEpochEnd(hooks ...Hook) {
+	t.onEpochEnd = append(t.onEpochEnd, hooks...)
+}
+
+// OnEvaluate registers hooks called after every evaluation of the validation set, see WithValidation
+func (t *Trainer) OnEvaluate(hooks ...Hook) {
+	t.onEvaluate = append(t.onEvaluate, hooks...)
+}
+
+// OnCheckpoint registers hooks called when the training should be saved: after an evaluation lowering
+// the validation loss, every n steps set by WithCheckpointEvery, and once the training is interrupted.
+// Their infos hold the State to resume the training from
+func (t *Trainer) OnCheckpoint(hooks ...Hook) {
+	t.onCheckpoint = append(t.onCheckpoint, hooks...)
+}
+
+// Run trains the model on dset and returns the infos of the last step. It returns io.EOF once every epoch
+// is read, ErrEarlyStop when the validation loss stops decreasing, or the error of a hook.
+// Once ctx is cancelled, the current step finishes, the OnCheckpoint hooks are given the Interrupted infos
+// and Run returns them with a nil error
+func (t *Trainer) Run(ctx context.Context, dset datasetter.FullTrainer) (TrainingInfos, error) {
+	options := t.options
+	session, err := t.model.newTrainSession(dset, t.solver, options)
+	if err != nil {
+		return TrainingInfos{}, err
+	}
+	step := 0
+	// lowest validation loss and number of evaluations since it was reached
+	bestLoss := float32(-1)
+	stale := 0
+	if options.resume != nil {
+		step = options.resume.Step
+		bestLoss = options.resume.BestLoss
+		stale = options.resume.Stale
+	}
+	last := TrainingInfos{
+		Step:  step,
+		Epoch: session.epoch,
+		State: session.state(step, bestLoss, stale),
+	}
+	for {
+		if ctx.Err() != nil {
+			return t.interrupt(last)
+		}
+		cost, perplexity, err := session.step(step + 1)
+		if err == io.EOF {
+			if err := runHooks(t.onEpochEnd, last); err != nil {
+				return last, err
+			}
+			if !session.nextEpoch() {
+				return last, io.EOF
+			}
+			last.State = session.state(step, bestLoss, stale)
+			continue
+		}
+		if err != nil {
+			return last, err
+		}
+		step++
+		infos := TrainingInfos{
+			Perplexity: perplexity,
+			Cost:       cost,
+			Step:       step,
+			Epoch:      session.epoch,
+			Tokens:     session.tokens,
+		}
+		infos.LearnRate, _ = G.LearnRateOf(t.solver)
+		if reporter, ok := t.solver.(G.GradStatsReporter); ok {
+			infos.Gradients = reporter.GradStats()
+		}
+		if options.validation != nil && options.validateEvery > 0 && step%options.validateEvery == 0 {
+			validation, err := options.validation()
+			if err != nil {
+				return infos, err
+			}
+			evaluation, err := t.model.Evaluate(ctx, validation)
+			if err != nil && ctx.Err() != nil {
+				// the weights are the ones of the last step, only its evaluation is lost
+				infos.State = session.state(step, bestLoss, stale)
+				return t.interrupt(infos)
+			}
+			if err != nil {
+				return infos, err
+			}
+			infos.Validated = true
+			infos.ValidationLoss = evaluation.Loss
+			infos.ValidationPerplexity = evaluation.Perplexity
+			if observer, ok := t.solver.(G.Observer); ok {
+				observer.Observe(float64(evaluation.Loss))
+			}
+			if bestLoss < 0 || evaluation.Loss < bestLoss {
+				bestLoss = evaluation.Loss
+				infos.Best = true
+				stale = 0
+			} else {
+				stale++
+			}
+		}
+		infos.State = session.state(step, bestLoss, stale)
+		last = infos
+
+		if err := runHooks(t.onStep, infos); err != nil {
+			return infos, err
+		}
+		if infos.Validated {
+			if err := runHooks(t.onEvaluate, infos); err != nil {
+				return infos, err
+			}
+		}
+		if infos.Best || (options.checkpointEvery > 0 && step%options.checkpointEvery == 0) {
+			if err := runHooks(t.onCheckpoint, infos); err != nil {
+				return infos, err
+			}
+		}
+		if infos.Validated && options.patience > 0 && stale >= options.patience {
+			return infos, ErrEarlyStop
+		}
+	}
+}
+
+// interrupt gives the infos of the last step to the OnCheckpoint hooks
+func (t *Trainer) interrupt(last TrainingInfos) (TrainingInfos, error) {
+	infos := TrainingInfos{
+		Step:        last.Step,
+		Epoch:       last.Epoch,
+		Perplexity:  last.Perplexity,
+		Cost:        last.Cost,
+		LearnRate:   last.LearnRate,
+		Gradients:   last.Gradients,
+		Tokens:      last.Tokens,
+		State:       last.State,
+		Interrupted: true,
+	}
+	return infos, runHooks(t.onCheckpoint, infos)
+}
+
+func runHooks(hooks []Hook, infos TrainingInfos) error {
+	for _, hook := range hooks {
+		if err := hook(infos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
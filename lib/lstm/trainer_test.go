@@ -0,0 +1,89 @@
+package lstm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/owulveryck/lstm/datasetter"
+	G "gorgonia.org/gorgonia"
+)
+
+func TestTrainerHooks(t *testing.T) {
+	m := newModelFromBackends(testBackends(5, 5, 4))
+	validation := func() (datasetter.FullTrainer, error) {
+		return &finiteSet{sequenceSet: sequenceSet{inputs: []int{1, 2}, targets: []int{2, 3}}, count: 1}, nil
+	}
+	trainer := NewTrainer(m, G.NewAdamSolver(), WithEpochs(2), WithValidation(validation, 2, 0), WithCheckpointEvery(3))
+	var calls []string
+	var steps, epochs []int
+	trainer.OnStep(func(infos TrainingInfos) error {
+		calls = append(calls, "step")
+		steps = append(steps, infos.Step)
+		if infos.Tokens == 0 {
+			t.Fatalf("step %v learned no token", infos.Step)
+		}
+		// the model can be read between two steps
+		_, err := m.MarshalBinary()
+		return err
+	})
+	trainer.OnEpochEnd(func(infos TrainingInfos) error {
+		calls = append(calls, "epoch")
+		epochs = append(epochs, infos.Epoch)
+		return nil
+	})
+	trainer.OnEvaluate(func(infos TrainingInfos) error {
+		calls = append(calls, "evaluate")
+		if !infos.Validated || infos.Step%2 != 0 {
+			t.Fatalf("unexpected evaluation at step %v", infos.Step)
+		}
+		return nil
+	})
+	trainer.OnCheckpoint(func(infos TrainingInfos) error {
+		calls = append(calls, "checkpoint")
+		if !infos.Best && infos.Step%3 != 0 {
+			t.Fatalf("unexpected checkpoint at step %v", infos.Step)
+		}
+		if infos.State.Step != infos.Step {
+			t.Fatalf("the checkpoint of step %v holds the state of step %v", infos.Step, infos.State.Step)
+		}
+		return nil
+	})
+
+	last, err := trainer.Run(context.Background(), newShuffledSet(7))
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	for i, step := range steps {
+		if step != i+1 {
+			t.Fatalf("the steps should be consecutive, got %v", steps)
+		}
+	}
+	if last.Step != len(steps) || len(epochs) != 2 || epochs[0] != 0 || epochs[1] != 1 {
+		t.Fatalf("bad last step %v or epochs %v", last.Step, epochs)
+	}
+	// the second step is evaluated, and the evaluation lowers the validation loss
+	expected := []string{"step", "step", "evaluate", "checkpoint", "step", "checkpoint"}
+	for i, call := range expected {
+		if calls[i] != call {
+			t.Fatalf("expected the calls %v, got %v", expected, calls[:len(expected)])
+		}
+	}
+}
+
+func TestTrainerHookError(t *testing.T) {
+	m := newModelFromBackends(testBackends(5, 5, 4))
+	trainer := NewTrainer(m, G.NewAdamSolver(), WithEpochs(2))
+	errStop := errors.New("stop")
+	trainer.OnStep(func(infos TrainingInfos) error {
+		if infos.Step == 3 {
+			return errStop
+		}
+		return nil
+	})
+	last, err := trainer.Run(context.Background(), newShuffledSet(7))
+	if err != errStop || last.Step != 3 {
+		t.Fatalf("the training should stop at step 3 with the error of the hook, got step %v and %v", last.Step, err)
+	}
+}
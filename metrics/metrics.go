@@ -0,0 +1,160 @@
+// Package metrics writes the measures of a training as JSON lines, CSV or TensorBoard event files,
+// so runs can be followed and compared offline.
+package metrics
+
+import (
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/owulveryck/lstm"
+)
+
+// Record holds the measures of a training step
+type Record struct {
+	Time  time.Time `json:"time"`
+	Step  int       `json:"step"`
+	Epoch int       `json:"epoch"`
+	// Loss is the mean loss of the tokens of the step in nats, and Perplexity is e^Loss, as the
+	// ValidationPerplexity is e^ValidationLoss
+	Loss       float64 `json:"loss"`
+	Perplexity float64 `json:"perplexity"`
+	LearnRate  float64 `json:"learn_rate"`
+	// GradNorm is the global norm of the gradients, zero if the solver does not report it
+	GradNorm float64 `json:"grad_norm"`
+	// TokensPerSec and ETA are filled by a Progress; ETA is the estimated remaining time in seconds,
+	// zero when unknown
+	TokensPerSec float64 `json:"tokens_per_sec"`
+	ETA          float64 `json:"eta"`
+	// Validated is true if the model has been evaluated on the validation set after the step
+	Validated            bool    `json:"validated,omitempty"`
+	ValidationLoss       float64 `json:"validation_loss,omitempty"`
+	ValidationPerplexity float64 `json:"validation_perplexity,omitempty"`
+}
+
+// NewRecord returns the record of the step of infos, taken at t
+func NewRecord(infos lstm.TrainingInfos, t time.Time) Record {
+	r := Record{
+		Time:       t,
+		Step:       infos.Step,
+		Epoch:      infos.Epoch,
+		Loss:       float64(infos.Cost),
+		Perplexity: math.Exp(float64(infos.Cost)),
+		LearnRate:  infos.LearnRate,
+		GradNorm:   infos.Gradients.GlobalNorm,
+	}
+	if infos.Validated {
+		r.Validated = true
+		r.ValidationLoss = float64(infos.ValidationLoss)
+		r.ValidationPerplexity = float64(infos.ValidationPerplexity)
+	}
+	return r
+}
+
+// Sink is where records are written
+type Sink interface {
+	Write(r Record) error
+	// Close flushes the records and closes the underlying writer if it is an io.Closer
+	Close() error
+}
+
+// Multi returns a Sink writing the records to every sink
+func Multi(sinks ...Sink) Sink {
+	return multiSink(sinks)
+}
+
+type multiSink []Sink
+
+func (m multiSink) Write(r Record) error {
+	for _, s := range m {
+		if err := s.Write(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiSink) Close() error {
+	var first error
+	for _, s := range m {
+		if err := s.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Create returns a Sink writing to the file at path: CSV if its extension is .csv, JSON lines otherwise
+func Create(path string) (Sink, error) {
+	return openFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+}
+
+// Append is Create adding the records to the end of the file at path, such as the records of a resumed
+// training. The header of a CSV file is only written if the file is empty
+func Append(path string) (Sink, error) {
+	return openFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+}
+
+func openFile(path string, flag int) (Sink, error) {
+	f, err := os.OpenFile(path, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) != ".csv" {
+		return NewJSONL(f), nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s := NewCSV(f)
+	s.header = info.Size() > 0
+	return s, nil
+}
+
+// Progress measures the throughput of a training and estimates its remaining time
+type Progress struct {
+	start     time.Time
+	startDone float64
+	last      time.Time
+	tokens    int
+}
+
+// NewProgress starts measuring at start a training of which the fraction done is already done,
+// such as a resumed training
+func NewProgress(start time.Time, done float64) *Progress {
+	return &Progress{
+		start:     start,
+		startDone: done,
+		last:      start,
+	}
+}
+
+// Add counts the tokens learned by a step
+func (p *Progress) Add(tokens int) {
+	p.tokens += tokens
+}
+
+// Measure fills the throughput of r since the previous measure and the remaining time of the training,
+// done being the fraction of the training done at the time of r
+func (p *Progress) Measure(r *Record, done float64) {
+	if elapsed := r.Time.Sub(p.last).Seconds(); elapsed > 0 {
+		r.TokensPerSec = float64(p.tokens) / elapsed
+		p.tokens = 0
+		p.last = r.Time
+	}
+	if progress := done - p.startDone; progress > 0 && done <= 1 {
+		r.ETA = r.Time.Sub(p.start).Seconds() * (1 - done) / progress
+	}
+}
+
+// closeWriter closes w if it is an io.Closer
+func closeWriter(w io.Writer) error {
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
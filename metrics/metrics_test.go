@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/owulveryck/lstm"
+)
+
+var start = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func testRecords() []Record {
+	return []Record{
+		{Time: start, Step: 1, Loss: 2.5, Perplexity: 3.6, LearnRate: 1e-3, GradNorm: 0.5},
+		{Time: start.Add(time.Second), Step: 2, Epoch: 1, Loss: 2, Validated: true, ValidationLoss: 1.5, ValidationPerplexity: 4.5},
+	}
+}
+
+func TestNewRecord(t *testing.T) {
+	infos := lstm.TrainingInfos{Step: 3, Cost: 2, Perplexity: 2 / math.Ln2, Validated: true, ValidationLoss: 1.5, ValidationPerplexity: float32(math.Exp(1.5))}
+	r := NewRecord(infos, start)
+	// both perplexities are e^loss, the loss being in nats
+	if math.Abs(r.Perplexity-math.Exp(r.Loss)) > 1e-9 || math.Abs(r.ValidationPerplexity-math.Exp(r.ValidationLoss)) > 1e-6 {
+		t.Fatalf("bad perplexities %v and %v", r.Perplexity, r.ValidationPerplexity)
+	}
+}
+
+func TestJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONL(&buf)
+	for _, r := range testRecords() {
+		if err := sink.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || strings.Contains(lines[0], "validation") {
+		t.Fatalf("bad lines %q", lines)
+	}
+	for i, line := range lines {
+		var r Record
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatal(err)
+		}
+		if expected := testRecords()[i]; !r.Time.Equal(expected.Time) || r.Step != expected.Step || r.ValidationLoss != expected.ValidationLoss {
+			t.Fatalf("expected %+v, got %+v", expected, r)
+		}
+	}
+}
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewCSV(&buf)
+	for _, r := range testRecords() {
+		if err := sink.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || strings.Join(rows[0], ",") != strings.Join(csvHeader, ",") {
+		t.Fatalf("bad rows %q", rows)
+	}
+	if rows[1][1] != "1" || rows[1][3] != "2.5" || rows[1][9] != "" {
+		t.Fatalf("bad row %q", rows[1])
+	}
+	if rows[2][2] != "1" || rows[2][9] != "1.5" || rows[2][10] != "4.5" {
+		t.Fatalf("bad row %q", rows[2])
+	}
+}
+
+func TestAppend(t *testing.T) {
+	dir := t.TempDir()
+	write := func(open func(string) (Sink, error), path string, r Record) {
+		sink, err := open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Write(r); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records := testRecords()
+
+	// the records of the resumed training follow the ones of the first run, under a single header
+	csvPath := filepath.Join(dir, "metrics.csv")
+	write(Create, csvPath, records[0])
+	write(Append, csvPath, records[1])
+	data, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][0] != csvHeader[0] || rows[1][1] != "1" || rows[2][1] != "2" {
+		t.Fatalf("bad rows %q", rows)
+	}
+
+	// a new file gets its header
+	newPath := filepath.Join(dir, "new.csv")
+	write(Append, newPath, records[0])
+	if data, err = os.ReadFile(newPath); err != nil {
+		t.Fatal(err)
+	}
+	if rows, err = csv.NewReader(bytes.NewReader(data)).ReadAll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0][0] != csvHeader[0] {
+		t.Fatalf("bad rows %q", rows)
+	}
+
+	jsonPath := filepath.Join(dir, "metrics.jsonl")
+	write(Create, jsonPath, records[0])
+	write(Append, jsonPath, records[1])
+	if data, err = os.ReadFile(jsonPath); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", lines)
+	}
+
+	// Create starts the file over
+	write(Create, jsonPath, records[1])
+	if data, err = os.ReadFile(jsonPath); err != nil {
+		t.Fatal(err)
+	}
+	var r Record
+	if err := json.Unmarshal(data, &r); err != nil || r.Step != 2 {
+		t.Fatalf("expected the single record of step 2, got %q", data)
+	}
+}
+
+// readEvents splits a TFRecord stream into its records, checking their checksums
+func readEvents(t *testing.T, data []byte) [][]byte {
+	var events [][]byte
+	for len(data) > 0 {
+		if len(data) < 16 {
+			t.Fatalf("truncated record of %v bytes", len(data))
+		}
+		n := binary.LittleEndian.Uint64(data)
+		if binary.LittleEndian.Uint32(data[8:]) != maskedCRC(data[:8]) {
+			t.Fatal("bad checksum of the length")
+		}
+		event := data[12 : 12+n]
+		if binary.LittleEndian.Uint32(data[12+n:]) != maskedCRC(event) {
+			t.Fatal("bad checksum of the event")
+		}
+		events = append(events, event)
+		data = data[16+n:]
+	}
+	return events
+}
+
+func TestEventWriter(t *testing.T) {
+	var buf bytes.Buffer
+	e, err := NewEventWriter(&buf, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range testRecords() {
+		if err := e.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events := readEvents(t, buf.Bytes())
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %v", len(events))
+	}
+	if !bytes.Contains(events[0], []byte(fileVersion)) {
+		t.Fatal("the first event should hold the file version")
+	}
+	// wall time, then the step
+	first := events[1]
+	if first[0] != 0x09 || math.Float64frombits(binary.LittleEndian.Uint64(first[1:])) != seconds(start) {
+		t.Fatalf("bad wall time % x", first[:9])
+	}
+	if first[9] != 0x10 || first[10] != 1 {
+		t.Fatalf("bad step % x", first[9:11])
+	}
+	// the loss scalar: its tag then its value as a float
+	loss := append(appendBytes(nil, 1, []byte("train/loss")), 0x15)
+	i := bytes.Index(first, loss)
+	if i < 0 || math.Float32frombits(binary.LittleEndian.Uint32(first[i+len(loss):])) != 2.5 {
+		t.Fatal("the event should hold the loss")
+	}
+	if bytes.Contains(first, []byte("validation/loss")) || !bytes.Contains(events[2], []byte("validation/loss")) {
+		t.Fatal("only the validated step should hold the validation loss")
+	}
+}
+
+func TestProgress(t *testing.T) {
+	// a resumed training, a quarter of it done
+	p := NewProgress(start, 0.25)
+	p.Add(100)
+	p.Add(300)
+	r := Record{Time: start.Add(2 * time.Second)}
+	p.Measure(&r, 0.5)
+	// a quarter has been done in 2 seconds, the remaining half takes 4
+	if r.TokensPerSec != 200 || r.ETA != 4 {
+		t.Fatalf("expected 200 tokens/s and 4s left, got %v and %v", r.TokensPerSec, r.ETA)
+	}
+	p.Add(50)
+	r = Record{Time: start.Add(3 * time.Second)}
+	p.Measure(&r, 0.5)
+	if r.TokensPerSec != 50 {
+		t.Fatalf("the throughput should be measured since the previous measure, got %v", r.TokensPerSec)
+	}
+}
@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// EventWriter writes the records as scalar summaries of a TensorBoard event file, so runs can be
+// compared with `tensorboard --logdir`. The events are encoded by hand to avoid depending on
+// the protocol buffers of TensorFlow
+type EventWriter struct {
+	w io.Writer
+}
+
+// fileVersion is the version of the event files TensorBoard reads
+const fileVersion = "brain.Event:2"
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// NewEventWriter returns an EventWriter writing to w, after writing the version of the file
+func NewEventWriter(w io.Writer, t time.Time) (*EventWriter, error) {
+	e := &EventWriter{w: w}
+	event := appendDouble(nil, 1, seconds(t))
+	event = appendBytes(event, 3, []byte(fileVersion))
+	if err := e.writeRecord(event); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// NewEventFile creates an event file in dir, named as TensorBoard expects
+func NewEventFile(dir string) (*EventWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	now := time.Now()
+	f, err := os.Create(filepath.Join(dir, fmt.Sprintf("events.out.tfevents.%d.%s", now.Unix(), host)))
+	if err != nil {
+		return nil, err
+	}
+	e, err := NewEventWriter(f, now)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// Write writes the measures of r as the scalars train/... and validation/... of its step
+func (e *EventWriter) Write(r Record) error {
+	var summary []byte
+	scalar := func(tag string, v float64) {
+		value := appendBytes(nil, 1, []byte(tag))
+		value = appendFloat(value, 2, float32(v))
+		summary = appendBytes(summary, 1, value)
+	}
+	scalar("train/loss", r.Loss)
+	scalar("train/perplexity", r.Perplexity)
+	scalar("train/learn_rate", r.LearnRate)
+	scalar("train/grad_norm", r.GradNorm)
+	scalar("train/tokens_per_sec", r.TokensPerSec)
+	if r.Validated {
+		scalar("validation/loss", r.ValidationLoss)
+		scalar("validation/perplexity", r.ValidationPerplexity)
+	}
+	event := appendDouble(nil, 1, seconds(r.Time))
+	event = appendVarint(event, 2, uint64(r.Step))
+	event = appendBytes(event, 5, summary)
+	return e.writeRecord(event)
+}
+
+// Close closes the underlying writer
+func (e *EventWriter) Close() error {
+	return closeWriter(e.w)
+}
+
+// writeRecord frames data as a TFRecord: its length, the checksum of the length, data and its checksum
+func (e *EventWriter) writeRecord(data []byte) error {
+	record := make([]byte, 12, 16+len(data))
+	binary.LittleEndian.PutUint64(record, uint64(len(data)))
+	binary.LittleEndian.PutUint32(record[8:], maskedCRC(record[:8]))
+	record = append(record, data...)
+	record = binary.LittleEndian.AppendUint32(record, maskedCRC(data))
+	_, err := e.w.Write(record)
+	return err
+}
+
+// maskedCRC is the CRC-32C checksum masked as TFRecord files expect
+func maskedCRC(data []byte) uint32 {
+	crc := crc32.Checksum(data, crc32c)
+	return (crc>>15 | crc<<17) + 0xa282ead8
+}
+
+func seconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+// the fields of the protocol buffers messages Event, Summary and Summary.Value
+
+func appendTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wireType))
+}
+
+func appendVarint(b []byte, field int, v uint64) []byte {
+	return binary.AppendUvarint(appendTag(b, field, 0), v)
+}
+
+func appendDouble(b []byte, field int, v float64) []byte {
+	return binary.LittleEndian.AppendUint64(appendTag(b, field, 1), math.Float64bits(v))
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(appendTag(b, field, 2), uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendFloat(b []byte, field int, v float32) []byte {
+	return binary.LittleEndian.AppendUint32(appendTag(b, field, 5), math.Float32bits(v))
+}
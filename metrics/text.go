@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// JSONL writes every record as a JSON object on its own line
+type JSONL struct {
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// NewJSONL returns a JSONL sink writing to w
+func NewJSONL(w io.Writer) *JSONL {
+	return &JSONL{
+		w:   w,
+		enc: json.NewEncoder(w),
+	}
+}
+
+// Write writes a line
+func (s *JSONL) Write(r Record) error {
+	return s.enc.Encode(r)
+}
+
+// Close closes the underlying writer
+func (s *JSONL) Close() error {
+	return closeWriter(s.w)
+}
+
+// csvHeader names the columns of the CSV sink
+var csvHeader = []string{
+	"time", "step", "epoch", "loss", "perplexity", "learn_rate", "grad_norm", "tokens_per_sec", "eta",
+	"validation_loss", "validation_perplexity",
+}
+
+// CSV writes the records as comma separated values under a header.
+// The validation columns are empty for the steps that have not been evaluated
+type CSV struct {
+	w      io.Writer
+	csv    *csv.Writer
+	header bool
+}
+
+// NewCSV returns a CSV sink writing to w
+func NewCSV(w io.Writer) *CSV {
+	return &CSV{
+		w:   w,
+		csv: csv.NewWriter(w),
+	}
+}
+
+// Write writes a row, preceded by the header for the first one
+func (s *CSV) Write(r Record) error {
+	if !s.header {
+		if err := s.csv.Write(csvHeader); err != nil {
+			return err
+		}
+		s.header = true
+	}
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	row := []string{
+		r.Time.Format(time.RFC3339Nano), strconv.Itoa(r.Step), strconv.Itoa(r.Epoch),
+		f(r.Loss), f(r.Perplexity), f(r.LearnRate), f(r.GradNorm), f(r.TokensPerSec), f(r.ETA),
+		"", "",
+	}
+	if r.Validated {
+		row[9], row[10] = f(r.ValidationLoss), f(r.ValidationPerplexity)
+	}
+	if err := s.csv.Write(row); err != nil {
+		return err
+	}
+	// the file can be read while the training goes on
+	s.csv.Flush()
+	return s.csv.Error()
+}
+
+// Close closes the underlying writer
+func (s *CSV) Close() error {
+	s.csv.Flush()
+	if err := s.csv.Error(); err != nil {
+		return err
+	}
+	return closeWriter(s.w)
+}
@@ -102,3 +102,7 @@ func (v Vocabulary[string, int]) IdxToToken(i int) (string, error) {
 
 	return "", fmt.Errorf("Invalid index: %v ", i)
 }
+
+func NewVocabFromInference[K string, V int](v InferenceVocabulary[K, V]) *Vocabulary[K, V] {
+	return &Vocabulary[K, V]{Forward: v.Forward, Inverse: v.Inverse, Immutable: true}
+}